@@ -0,0 +1,15 @@
+package gunzip
+
+import (
+	"encoding/binary"
+)
+
+// BGZFBlockSize returns the total size of a BGZF member as recorded in the
+// BC subfield of its extra field, and false if the header has none
+func BGZFBlockSize(h *Header) (int, bool) {
+	data, ok := h.Subfield('B', 'C')
+	if !ok || len(data) != 2 {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint16(data)) + 1, true
+}
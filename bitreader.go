@@ -1,8 +1,7 @@
-package main
+package gunzip
 
 import (
 	"encoding/binary"
-	"errors"
 	"io"
 )
 
@@ -16,6 +15,7 @@ type BitRead interface {
 	HasDataLeft() (bool, error)
 	Read(p []byte) (n int, err error)
 	ReadExact(p []byte) error
+	BitOffset() int64
 }
 
 type BitReader struct {
@@ -23,6 +23,7 @@ type BitReader struct {
 	nbits      int
 	buf        []byte
 	begin, cap int
+	offset     int64 // number of bytes read from reader
 }
 
 func NewBitReader(reader io.Reader) *BitReader {
@@ -35,25 +36,55 @@ func NewBitReader(reader io.Reader) *BitReader {
 	}
 }
 
+// Reset discards all buffered data and continues reading from reader
+func (r *BitReader) Reset(reader io.Reader) {
+	r.reader = reader
+	r.nbits = 0
+	r.begin = 0
+	r.cap = 0
+	r.offset = 0
+}
+
 func (r *BitReader) Read(b []byte) (n int, err error) {
 	r.ByteAlign()
 	n = min(len(b), len(r.buffer()))
 	copy(b, r.buffer()[:n])
 	r.begin += n
+	if n == len(b) {
+		return
+	}
 
 	m, err := r.reader.Read(b[n:])
+	r.offset += int64(m)
 	n += m
 	return
 }
 
+// Offset returns the number of input bytes consumed so far. A partially
+// consumed byte is not counted.
+func (r *BitReader) Offset() int64 {
+	return r.offset - int64(len(r.buffer()))
+}
+
+// BitOffset returns the number of input bits consumed so far
+func (r *BitReader) BitOffset() int64 {
+	return r.Offset()*8 + int64(r.nbits)
+}
+
 func (r *BitReader) PeekBits() (uint32, error) {
 	for len(r.buffer()) < 4 {
 		n, err := r.fillBuf()
+		if err == io.EOF && len(r.buffer()) > 0 {
+			// raw streams may end right after the last code, so pad with zeros
+			var tail [4]byte
+			copy(tail[:], r.buffer())
+			return binary.LittleEndian.Uint32(tail[:]) >> r.nbits, nil
+		}
 		if err != nil {
 			return 0, err
 		}
 		if n == 0 {
-			return 0, errors.New("unexpected EOF")
+			return 0, io.ErrNoProgress
 		}
 	}
 	bits := binary.LittleEndian.Uint32(r.buffer())
@@ -91,7 +122,8 @@ func (r *BitReader) ReadBits(n int) (uint32, error) {
 const BUFFER_SIZE int = 16 << 10
 
 func (r *BitReader) buffer() []byte {
-	return r.buf[r.begin:r.cap]
+	// a corrupt stream may consume padding past the end of input
+	return r.buf[min(r.begin, r.cap):r.cap]
 }
 
 func (r *BitReader) bitLen() int {
@@ -99,12 +131,12 @@ func (r *BitReader) bitLen() int {
 }
 
 func (r *BitReader) fillBuf() (int, error) {
-	copy(r.buf, r.buffer())
-	r.cap -= r.begin
+	r.cap = copy(r.buf, r.buffer())
 	r.begin = 0
 	n, err := r.reader.Read(r.buf[r.cap:])
 
 	r.cap += n
+	r.offset += int64(n)
 	return n, err
 }
 
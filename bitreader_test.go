@@ -0,0 +1,33 @@
+package gunzip
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+// stuckReader returns its data, then neither data nor an error
+type stuckReader struct {
+	data []byte
+}
+
+func (r *stuckReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestPeekBitsNoProgress(t *testing.T) {
+	r := NewBitReader(&stuckReader{[]byte{0xab}})
+	if _, err := r.PeekBits(); err != io.ErrNoProgress {
+		t.Errorf("PeekBits: got %v, want %v", err, io.ErrNoProgress)
+	}
+
+	// the decoder fails rather than spinning on such a reader
+	input := gzipData(t, []byte("data"))
+	_, err := io.ReadAll(NewReader(&stuckReader{input[:len(input)/2]}))
+	if !errors.Is(err, io.ErrNoProgress) {
+		t.Errorf("decoding: got %v, want %v", err, io.ErrNoProgress)
+	}
+
+}
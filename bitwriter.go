@@ -0,0 +1,91 @@
+package gunzip
+
+import (
+	"io"
+)
+
+// BitWriter packs bits LSB first, the bit order used by DEFLATE
+type BitWriter struct {
+	writer io.Writer
+	bits   uint64
+	nbits  int
+	buf    []byte
+	err    error
+}
+
+func NewBitWriter(writer io.Writer) *BitWriter {
+	return &BitWriter{
+		writer: writer,
+		bits:   0,
+		nbits:  0,
+		buf:    make([]byte, 0, bufferSize),
+		err:    nil,
+	}
+}
+
+// Reset discards buffered bits and errors and switches to writer
+func (w *BitWriter) Reset(writer io.Writer) {
+	w.writer = writer
+	w.bits = 0
+	w.nbits = 0
+	w.buf = w.buf[:0]
+	w.err = nil
+}
+
+// WriteBits appends the n low bits of bits, n <= 32
+func (w *BitWriter) WriteBits(bits uint32, n int) {
+	w.bits |= uint64(bits) << w.nbits
+	w.nbits += n
+	if w.nbits >= 32 {
+		w.buf = append(w.buf, byte(w.bits), byte(w.bits>>8), byte(w.bits>>16), byte(w.bits>>24))
+		w.bits >>= 32
+		w.nbits -= 32
+		if len(w.buf) >= bufferSize-4 {
+			w.flushBuf()
+		}
+	}
+}
+
+// ByteAlign pads with zero bits up to the next byte boundary
+func (w *BitWriter) ByteAlign() {
+	if w.nbits%8 != 0 {
+		w.WriteBits(0, 8-w.nbits%8)
+	}
+}
+
+// Write writes p after aligning to a byte boundary
+func (w *BitWriter) Write(p []byte) (int, error) {
+	w.ByteAlign()
+	for w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.bits))
+		w.bits >>= 8
+		w.nbits -= 8
+	}
+	if len(w.buf)+len(p) <= cap(w.buf) {
+		w.buf = append(w.buf, p...)
+		return len(p), w.err
+	}
+	w.flushBuf()
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.writer.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Flush aligns to a byte boundary and writes all buffered bytes
+func (w *BitWriter) Flush() error {
+	w.Write(nil)
+	w.flushBuf()
+	return w.err
+}
+
+func (w *BitWriter) flushBuf() {
+	if w.err == nil && len(w.buf) > 0 {
+		_, w.err = w.writer.Write(w.buf)
+	}
+	w.buf = w.buf[:0]
+}
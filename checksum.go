@@ -1,6 +1,8 @@
-package main
+package gunzip
 
 import (
+	"hash"
+	"hash/adler32"
 	"hash/crc32"
 )
 
@@ -9,6 +11,7 @@ type Checksum interface {
 	Checksum() uint32
 	Len() int
 	ResetLen()
+	Reset()
 }
 
 type Crc32 struct {
@@ -38,3 +41,109 @@ func (c *Crc32) Len() int {
 func (c *Crc32) ResetLen() {
 	c.n = 0
 }
+
+// Reset clears both the checksum and the length
+func (c *Crc32) Reset() {
+	c.sum = 0
+	c.n = 0
+}
+
+// Adler32 is the checksum of zlib streams
+type Adler32 struct {
+	hash hash.Hash32
+	n    int
+}
+
+func NewAdler32() *Adler32 {
+	return &Adler32{adler32.New(), 0}
+}
+
+func (a *Adler32) Update(xs []byte) {
+	a.n += len(xs)
+	a.hash.Write(xs)
+}
+
+func (a *Adler32) Checksum() uint32 {
+	sum := a.hash.Sum32()
+	a.hash.Reset()
+	return sum
+}
+
+func (a *Adler32) Len() int {
+	return a.n
+}
+
+func (a *Adler32) ResetLen() {
+	a.n = 0
+}
+
+// Reset clears both the checksum and the length
+func (a *Adler32) Reset() {
+	a.hash.Reset()
+	a.n = 0
+}
+
+// Combine appends the CRC32 of a block of n bytes whose checksum is sum, as
+// if the block had been passed to Update
+func (c *Crc32) Combine(sum uint32, n int) {
+	c.sum = Crc32Combine(c.sum, sum, int64(n))
+	c.n += n
+}
+
+// Crc32Combine returns the CRC32 of the concatenation of two blocks given
+// their checksums and the length of the second block, using zlib's method of
+// applying the zero-byte operator in GF(2)
+func Crc32Combine(crc1 uint32, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1
+	}
+	var even, odd [32]uint32
+
+	// operator for one zero bit
+	odd[0] = crc32.IEEE
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(even[:], odd[:]) // two zero bits
+	gf2MatrixSquare(odd[:], even[:]) // four zero bits
+
+	// apply len2 zero bytes to crc1, squaring the operator each step
+	for {
+		gf2MatrixSquare(even[:], odd[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(even[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(odd[:], even[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(odd[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i++ {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+		vec >>= 1
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square []uint32, mat []uint32) {
+	for n := 0; n < 32; n++ {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
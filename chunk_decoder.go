@@ -0,0 +1,205 @@
+package gunzip
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Symbols decoded without knowing the preceding window are uint16. Values
+// below MarkerBase are bytes; a value of MarkerBase+i is a marker standing for
+// byte i of the MAX_DISTANCE window preceding the chunk, resolved once that
+// window is known.
+const MarkerBase = 1 << 15
+
+var fixedLLDecoder = NewHuffmanDecoder(NewDefaultLLCodebook())
+var fixedDistDecoder = NewHuffmanDecoder(NewDefaultDistCodebook())
+
+// emptyDecoder stands for the codes of a block not read yet
+var emptyDecoder = EmptyHuffmanDecoder()
+
+// ChunkDecoder decodes DEFLATE blocks starting at an arbitrary bit offset of
+// a gzip file, following member boundaries
+type ChunkDecoder struct {
+	reader  *BitReader
+	start   int64    // bit offset of the first byte handed to reader
+	out     []uint16 // MAX_DISTANCE window followed by the decoded symbols
+	footers []chunkFooter
+	cancel  *atomic.Bool
+	garbage error // TrailingGarbage if data that is not a member follows
+}
+
+type chunkFooter struct {
+	pos    int // number of symbols decoded before the footer
+	footer *Footer
+}
+
+// NewChunkDecoder returns a ChunkDecoder positioned at bit offset start of
+// input. The last bytes of the window preceding start may be given in window;
+// references to bytes before them decode to markers.
+func NewChunkDecoder(input io.ReaderAt, size int64, start int64, window []uint8) *ChunkDecoder {
+	reader := NewBitReader(io.NewSectionReader(input, start/8, size-start/8))
+	reader.Consume(int(start % 8))
+	out := make([]uint16, MAX_DISTANCE, 2*MAX_DISTANCE)
+	for i := range out {
+		out[i] = uint16(MarkerBase + i)
+	}
+	for i, b := range window[max(0, len(window)-MAX_DISTANCE):] {
+		out[MAX_DISTANCE-min(len(window), MAX_DISTANCE)+i] = uint16(b)
+	}
+	return &ChunkDecoder{reader: reader, start: start - start%8, out: out}
+}
+
+// BitOffset returns the bit offset of the decoder within the input
+func (c *ChunkDecoder) BitOffset() int64 {
+	return c.start + c.reader.BitOffset()
+}
+
+// Symbols returns the decoded symbols
+func (c *ChunkDecoder) Symbols() []uint16 {
+	return c.out[MAX_DISTANCE:]
+}
+
+// Run decodes blocks until reaching a block boundary at or after bit offset
+// stop, or once at least limit symbols are decoded. It reports whether the
+// input ended after a member footer, possibly followed by trailing garbage.
+func (c *ChunkDecoder) Run(stop int64, limit int) (eos bool, err error) {
+	for {
+		if c.BitOffset() >= stop || len(c.out)-MAX_DISTANCE >= limit {
+			return false, nil
+		}
+		if c.cancel != nil && c.cancel.Load() {
+			return false, nil
+		}
+		final, err := c.decodeBlock()
+		if err != nil {
+			return false, err
+		}
+		if !final {
+			continue
+		}
+
+		c.reader.ByteAlign()
+		footer, err := ReadFooter(c.reader)
+		if err != nil {
+			return false, eofIsUnexpected(err)
+		}
+		c.footers = append(c.footers, chunkFooter{len(c.out) - MAX_DISTANCE, footer})
+		dataLeft, err := c.reader.HasDataLeft()
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		if !dataLeft {
+			return true, nil
+		}
+		member, err := memberFollows(c.reader)
+		if e, ok := err.(*Error); ok {
+			e.BitOffset += c.start
+			c.garbage = e
+			return true, nil
+		}
+		if !member {
+			return err == nil, err
+		}
+		if _, err := readGzipHeader(c.reader); err != nil {
+			return false, eofIsUnexpected(err)
+		}
+	}
+}
+
+// decodeBlock decodes one block and reports whether it is the final one
+func (c *ChunkDecoder) decodeBlock() (bool, error) {
+	header, err := c.reader.ReadBits(3)
+	if err != nil {
+		return false, eofIsUnexpected(err)
+	}
+	final := header&1 == 1
+	var llDecoder, distDecoder *HuffmanDecoder
+	switch header >> 1 {
+	case 0:
+		return final, c.decodeStored()
+	case 1:
+		llDecoder, distDecoder = fixedLLDecoder, fixedDistDecoder
+	case 2:
+		llCodes, distCodes, err := ReadDynamicCodebooks(c.reader)
+		if err != nil {
+			return false, eofIsUnexpected(err)
+		}
+		llDecoder, distDecoder = NewHuffmanDecoder(llCodes), NewHuffmanDecoder(distCodes)
+	default:
+		return false, NewError(InvalidBlockType)
+	}
+
+	for {
+		code, err := ReadNextCode(c.reader, llDecoder, distDecoder)
+		if err != nil {
+			return false, eofIsUnexpected(err)
+		}
+		if code.Tag == Literal {
+			c.out = append(c.out, uint16(code.Value))
+		} else if code.Tag == Dictionary {
+			distance, length := int(code.Distance), int(code.Length)
+			begin := len(c.out) - distance
+			if begin < 0 {
+				return false, NewError(DistanceTooMuch)
+			}
+			if distance >= length {
+				c.out = append(c.out, c.out[begin:begin+length]...)
+			} else {
+				for i := 0; i < length; i++ {
+					c.out = append(c.out, c.out[begin+i])
+				}
+			}
+		} else {
+			return final, nil
+		}
+	}
+}
+
+func (c *ChunkDecoder) decodeStored() error {
+	c.reader.ByteAlign()
+	length, err := c.reader.ReadBits(16)
+	if err != nil {
+		return eofIsUnexpected(err)
+	}
+	nlength, err := c.reader.ReadBits(16)
+	if err != nil {
+		return eofIsUnexpected(err)
+	}
+	if length^nlength != 0xFFFF {
+		return NewError(BlockType0LenMismatch)
+	}
+	buf := make([]uint8, length)
+	if err := c.reader.ReadExact(buf); err != nil {
+		return eofIsUnexpected(err)
+	}
+	for _, b := range buf {
+		c.out = append(c.out, uint16(b))
+	}
+	return nil
+}
+
+// ResolveMarkers converts symbols to bytes, replacing markers with bytes of
+// window, the data preceding the chunk
+func ResolveMarkers(symbols []uint16, window []uint8) ([]uint8, error) {
+	out := make([]uint8, len(symbols))
+	missing := MAX_DISTANCE - len(window)
+	for i, symbol := range symbols {
+		if symbol < MarkerBase {
+			out[i] = uint8(symbol)
+			continue
+		}
+		idx := int(symbol-MarkerBase) - missing
+		if idx < 0 {
+			return nil, NewError(DistanceTooMuch)
+		}
+		out[i] = window[idx]
+	}
+	return out, nil
+}
+
+func eofIsUnexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gunzip"
+)
+
+// exit codes follow GNU gzip
+const (
+	exitOK      = 0
+	exitError   = 1
+	exitWarning = 2
+)
+
+type program struct {
+	name   string
+	opts   *options
+	status int
+}
+
+func main() {
+	p := &program{name: filepath.Base(os.Args[0])}
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", p.name, err)
+		fmt.Fprintf(os.Stderr, "Try '%s --help' for more information.\n", p.name)
+		os.Exit(exitError)
+	}
+	if opts.help {
+		fmt.Printf(usage, p.name)
+		os.Exit(exitOK)
+	}
+	p.opts = opts
+	p.run()
+	os.Exit(p.status)
+}
+
+// run processes the files given on the command line, as selected by the
+// subcommand and options
+func (p *program) run() {
+	opts := p.opts
+	files := opts.files
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	switch {
+	case opts.unzip:
+		for _, file := range opts.files {
+			p.unzipFile(file)
+		}
+		if len(opts.files) == 0 {
+			p.fail("unzip", errors.New("no archive given"))
+		}
+	case opts.untar:
+		// before -l, which lists the tar entries here
+		for _, file := range files {
+			p.untarFile(file)
+		}
+	case opts.list:
+		p.listFiles(files)
+	default:
+		for _, file := range files {
+			if opts.test {
+				p.testFile(file)
+			} else if file == "-" {
+				p.decompressStdin()
+			} else {
+				p.decompressFile(file)
+			}
+		}
+	}
+}
+
+// warn reports a problem that does not prevent processing other files
+func (p *program) warn(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", p.name, fmt.Sprintf(format, args...))
+	if p.status == exitOK {
+		p.status = exitWarning
+	}
+}
+
+// fail reports an error for the current file
+func (p *program) fail(name string, err error) {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s: %v\n", p.name, name, err)
+	p.status = exitError
+}
+
+// newDecompressor picks the decoder for the requested number of jobs: regular
+// files are decoded member by member if their member boundaries can be found,
+// as in BGZF or concatenated files, and in parallel chunks otherwise, streams
+// on a separate goroutine. Files in the legacy compress
+// and pack formats are always decoded sequentially.
+func (p *program) newDecompressor(reader io.Reader) io.Reader {
+	if p.opts.salvage {
+		if f, ok := reader.(*os.File); ok {
+			if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+				return gunzip.NewSalvageReader(f, info.Size())
+			}
+		}
+	}
+	if p.opts.jobs == 1 {
+		return gunzip.NewReader(reader)
+	}
+	if f, ok := reader.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			header, err := gunzip.ReadHeader(gunzip.NewBitReader(io.NewSectionReader(f, 0, info.Size())))
+			if err == nil && header.IsLegacy() {
+				return gunzip.NewReader(reader)
+			}
+			if err == nil && gunzip.IsMultiMember(f, info.Size()) {
+				return gunzip.NewDecompressorMultiMember(f, info.Size(), p.opts.jobs)
+			}
+			return gunzip.NewDecompressorParallel(f, info.Size(), p.opts.jobs)
+		}
+	}
+	return gunzip.NewDecompressorMultithreaded(reader)
+}
+
+// decode writes the decoded data of reader to w. In salvage mode the damaged
+// ranges are reported as warnings, and damaged is set if there were any.
+func (p *program) decode(name string, w io.Writer, reader io.Reader) (damaged bool, err error) {
+	decompressor := p.newDecompressor(reader)
+	if closer, ok := decompressor.(io.Closer); ok {
+		defer closer.Close()
+	}
+	_, err = io.Copy(w, decompressor)
+	err = p.trailing(name, err)
+	if salvage, ok := decompressor.(*gunzip.SalvageReader); ok {
+		for _, skip := range salvage.Skips {
+			p.warn("%s: %v", name, skip)
+		}
+		damaged = len(salvage.Skips) > 0
+	}
+	return damaged, err
+}
+
+// trailing warns about data after the last member, which gzip ignores, and
+// clears err if that was the only problem
+func (p *program) trailing(name string, err error) error {
+	if errors.Is(err, gunzip.TrailingGarbage) {
+		p.warn("%s: decompression OK, trailing garbage ignored", name)
+		return nil
+	}
+	return err
+}
+
+// checkStdin refuses to read compressed data from a terminal unless forced
+func (p *program) checkStdin() bool {
+	if !p.opts.force && isTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "%s: compressed data not read from a terminal. Use -f to force decompression.\n", p.name)
+		p.status = exitError
+		return false
+	}
+	return true
+}
+
+func (p *program) decompressStdin() {
+	if !p.checkStdin() {
+		return
+	}
+	_, err := p.decode("stdin", os.Stdout, os.Stdin)
+	if err != nil {
+		p.fail("stdin", err)
+	}
+}
+
+// testFile decodes a file, verifying every member's CRC32 and ISIZE, and
+// reports whether it is intact
+func (p *program) testFile(name string) {
+	var reader io.Reader
+	if name == "-" {
+		if !p.checkStdin() {
+			return
+		}
+		name, reader = "stdin", os.Stdin
+	} else {
+		inName, in, _, ok := p.openRegular(name)
+		if !ok {
+			return
+		}
+		defer in.Close()
+		name, reader = inName, in
+	}
+
+	var err error
+	if p.opts.salvage {
+		var damaged bool
+		damaged, err = p.decode(name, io.Discard, reader)
+		if err == nil && damaged {
+			err = errors.New("damaged data skipped")
+		}
+	} else if p.opts.jobs > 1 {
+		_, err = io.Copy(io.Discard, p.newDecompressor(reader))
+		err = p.trailing(name, err)
+	} else {
+		err = p.trailing(name, gunzip.Verify(reader))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s:\t FAIL (%v)\n", name, err)
+		p.status = exitError
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s:\t OK\n", name)
+}
+
+func (p *program) decompressFile(name string) {
+	inName, in, info, ok := p.openRegular(name)
+	if !ok {
+		return
+	}
+	defer in.Close()
+
+	if p.opts.stdout {
+		_, err := p.decode(inName, os.Stdout, in)
+		if err != nil {
+			p.fail(inName, err)
+		}
+		return
+	}
+
+	outName, ok := stripSuffix(inName, p.opts.suffix)
+	var modTime time.Time
+	if p.opts.name {
+		var stored string
+		stored, modTime = storedName(in, info.Size())
+		if stored != "" && filepath.Join(filepath.Dir(inName), stored) != inName {
+			outName, ok = filepath.Join(filepath.Dir(inName), stored), true
+		}
+	}
+	if !ok {
+		p.warn("%s: unknown suffix -- ignored", inName)
+		return
+	}
+	if _, err := os.Lstat(outName); err == nil {
+		if !p.opts.force {
+			p.warn("%s already exists; not overwritten", outName)
+			return
+		}
+		if err := os.Remove(outName); err != nil {
+			p.fail(outName, err)
+			return
+		}
+	}
+
+	out, err := os.OpenFile(outName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		p.fail(outName, err)
+		return
+	}
+	_, err = p.decode(inName, out, in)
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(outName)
+		p.fail(inName, err)
+		return
+	}
+
+	// carry over permissions and timestamps as gzip does
+	if err := os.Chmod(outName, info.Mode().Perm()); err != nil {
+		p.warn("%s: %v", outName, err)
+	}
+	if modTime.IsZero() {
+		modTime = info.ModTime()
+	}
+	if err := os.Chtimes(outName, modTime, modTime); err != nil {
+		p.warn("%s: %v", outName, err)
+	}
+	if !p.opts.keep && !p.opts.salvage {
+		in.Close()
+		if err := os.Remove(inName); err != nil {
+			p.fail(inName, err)
+		}
+	}
+}
+
+// storedName returns the file name and modification time recorded in the
+// header of the first member, for -N. Like gzip, the name is used as stored,
+// without any directory part; it is "" if there is none.
+func storedName(in *os.File, size int64) (string, time.Time) {
+	header, err := gunzip.ReadHeader(gunzip.NewBitReader(io.NewSectionReader(in, 0, size)))
+	if err != nil || header.IsLegacy() {
+		return "", time.Time{}
+	}
+	name := string(header.RawName)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	if name == "." || name == ".." {
+		name = ""
+	}
+	return name, header.ModTime()
+}
+
+// openRegular opens the input file for name, skipping anything that is not a
+// regular file
+func (p *program) openRegular(name string) (string, *os.File, os.FileInfo, bool) {
+	inName, info, err := p.openInput(name)
+	if err != nil {
+		p.fail(name, err)
+		return "", nil, nil, false
+	}
+	if info.IsDir() {
+		p.warn("%s is a directory -- ignored", inName)
+		return "", nil, nil, false
+	}
+	if !info.Mode().IsRegular() {
+		p.warn("%s is not a directory or a regular file - ignored", inName)
+		return "", nil, nil, false
+	}
+	in, err := os.Open(inName)
+	if err != nil {
+		p.fail(inName, err)
+		return "", nil, nil, false
+	}
+	return inName, in, info, true
+}
+
+// openInput locates the input file, trying name+suffix if name itself does
+// not exist
+func (p *program) openInput(name string) (string, os.FileInfo, error) {
+	info, err := os.Stat(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) || strings.HasSuffix(name, p.opts.suffix) {
+		return name, info, err
+	}
+	withSuffix := name + p.opts.suffix
+	if info, err := os.Stat(withSuffix); err == nil {
+		return withSuffix, info, nil
+	}
+	return name, nil, err
+}
+
+// stripSuffix returns the output name for a compressed file name, or false if
+// the name does not carry a known suffix
+func stripSuffix(name, suffix string) (string, bool) {
+	base := filepath.Base(name)
+	for _, suf := range []string{suffix, ".gz", "-gz", ".z", "-z", "_z", ".Z"} {
+		if len(base) > len(suf) && strings.HasSuffix(base, suf) {
+			return name[:len(name)-len(suf)], true
+		}
+	}
+	for _, suf := range []string{".tgz", ".taz", ".taZ"} {
+		if len(base) > len(suf) && strings.HasSuffix(base, suf) {
+			return name[:len(name)-len(suf)] + ".tar", true
+		}
+	}
+	return "", false
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gunzip"
+)
+
+// newTestProgram returns a program parsing args as the command line would
+func newTestProgram(t *testing.T, args ...string) *program {
+	t.Helper()
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &program{name: "gunzip", opts: opts}
+}
+
+// writeGzip writes data compressed with compress/gzip, followed by trailing,
+// to a file in dir
+func writeGzip(t *testing.T, dir string, name string, data []byte, trailing []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	buf.Write(trailing)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTrailingData(t *testing.T) {
+	want := []byte("decoded data")
+	tests := []struct {
+		name     string
+		trailing []byte
+		status   int
+	}{
+		{"none", nil, exitOK},
+		{"zero padding", make([]byte, 512), exitOK},
+		{"garbage", []byte("garbage"), exitWarning},
+	}
+	for _, test := range tests {
+		for _, jobs := range []string{"1", "4"} {
+			t.Run(test.name+"/jobs="+jobs, func(t *testing.T) {
+				dir := t.TempDir()
+				path := writeGzip(t, dir, "file.gz", want, test.trailing)
+				p := newTestProgram(t, "-j", jobs, path)
+				p.decompressFile(path)
+				if p.status != test.status {
+					t.Errorf("exit status %d, want %d", p.status, test.status)
+				}
+				got, err := os.ReadFile(filepath.Join(dir, "file"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTestTrailingGarbage(t *testing.T) {
+	path := writeGzip(t, t.TempDir(), "file.gz", []byte("data"), []byte("garbage"))
+	p := newTestProgram(t, "-t", path)
+	p.testFile(path)
+	if p.status != exitWarning {
+		t.Errorf("exit status %d, want %d", p.status, exitWarning)
+	}
+}
+
+func TestStripSuffix(t *testing.T) {
+	tests := []struct{ name, suffix, want string }{
+		{"a.gz", ".gz", "a"},
+		{"dir/b.tgz", ".gz", "dir/b.tar"},
+		{"c.Z", ".gz", "c"},
+		{"d.gzip", ".gzip", "d"},
+		{".gz", ".gz", ""},
+		{"e.txt", ".gz", ""},
+	}
+	for _, test := range tests {
+		got, ok := stripSuffix(test.name, test.suffix)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("stripSuffix(%q, %q) = %q, %v; want %q", test.name, test.suffix, got, ok, test.want)
+		}
+	}
+}
+
+func TestNewDecompressorConcatenated(t *testing.T) {
+	dir := t.TempDir()
+	first := writeGzip(t, dir, "first.gz", []byte("first member\n"), nil)
+	second := writeGzip(t, dir, "second.gz", []byte("second member\n"), nil)
+	a, _ := os.ReadFile(first)
+	b, _ := os.ReadFile(second)
+	path := filepath.Join(dir, "log.gz")
+	os.WriteFile(path, append(a, b...), 0644)
+
+	p := newTestProgram(t, "-j", "4", path)
+	for name, want := range map[string]bool{path: true, first: false} {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressor := p.newDecompressor(f)
+		_, ok := decompressor.(*gunzip.DecompressorMultiMember)
+		decompressor.(io.Closer).Close()
+		if ok != want {
+			t.Errorf("%s: member-parallel decoding %v, want %v", filepath.Base(name), ok, want)
+		}
+		f.Close()
+	}
+}
+
+func TestListLegacy(t *testing.T) {
+	// "ab" as written by compress
+	path := filepath.Join(t.TempDir(), "file.Z")
+	if err := os.WriteFile(path, []byte{0x1f, 0x9d, 0x90, 'a', 0xc4, 0x00}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := newTestProgram(t, "-l", path)
+	out := captureStdout(t, p.run)
+	if p.status != exitOK {
+		t.Errorf("exit status %d", p.status)
+	}
+	if want := path + ":1              6                    2"; !strings.Contains(out, want) {
+		t.Errorf("listing lacks %q:\n%s", want, out)
+	}
+}
+
+func TestPrintList(t *testing.T) {
+	var out bytes.Buffer
+	printList(&out, []listEntry{
+		{File: "a.gz", Member: 1, CompressedSize: 30, UncompressedSize: 120, Ratio: 75, MTime: 0, OS: 3, Name: "a"},
+		{File: "a.gz", Member: 2, CompressedSize: 20, UncompressedSize: 5 << 30, Ratio: 100, MTime: 0, OS: 255},
+	})
+	want := "      member     compressed         uncompressed   ratio mtime                os name\n" +
+		"      a.gz:1             30                  120   75.0% -                     3 a\n" +
+		"      a.gz:2             20           5368709120  100.0% -                   255 \n" +
+		"    (totals)             50           5368709240  100.0%\n"
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestTest(t *testing.T) {
+	dir := t.TempDir()
+	valid := writeGzip(t, dir, "valid.gz", []byte("data"), nil)
+	input, _ := os.ReadFile(valid)
+	multi := filepath.Join(dir, "multi.gz")
+	os.WriteFile(multi, append(bytes.Clone(input), input...), 0644)
+	badCrc := filepath.Join(dir, "crc.gz")
+	os.WriteFile(badCrc, append(bytes.Clone(input[:len(input)-8]), 0, 0, 0, 0, 4, 0, 0, 0), 0644)
+	garbage := writeGzip(t, dir, "garbage.gz", []byte("data"), []byte("garbage"))
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{valid, exitOK},
+		{multi, exitOK},
+		{badCrc, exitError},
+		{garbage, exitWarning},
+	}
+	for _, test := range tests {
+		for _, jobs := range []string{"1", "4"} {
+			p := newTestProgram(t, "-t", "-j", jobs, test.path)
+			p.run()
+			if p.status != test.status {
+				t.Errorf("%s with -j %s: exit status %d, want %d", test.path, jobs, p.status, test.status)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != len(tests) {
+		t.Errorf("-t wrote %d files", len(entries)-len(tests))
+	}
+}
+
+// writeNamed writes data compressed with name and modTime in the header to
+// a file in dir
+func writeNamed(t *testing.T, dir string, file string, name string, modTime time.Time, data []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Name, w.ModTime = name, modTime
+	w.Write(data)
+	w.Close()
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStoredName(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	tests := []struct {
+		stored, want string
+	}{
+		{"file.txt", "file.txt"},
+		{"dir/file.txt", "file.txt"},
+		{"/etc/passwd", "passwd"},
+		{`..\..\evil.txt`, "evil.txt"},
+		{"../evil.txt", "evil.txt"},
+		{"..", ""},
+		{"a/..", ""},
+		{".", ""},
+		{"dir/", ""},
+		{"", ""},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		in, err := os.Open(writeNamed(t, dir, "file.gz", test.stored, modTime, []byte("data")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _ := in.Stat()
+		name, mtime := storedName(in, info.Size())
+		in.Close()
+		if name != test.want || !mtime.Equal(modTime) {
+			t.Errorf("stored name %q: got %q %v, want %q", test.stored, name, mtime, test.want)
+		}
+	}
+}
+
+func TestDecompressStoredName(t *testing.T) {
+	outer := t.TempDir()
+	dir := filepath.Join(outer, "dir")
+	os.Mkdir(dir, 0755)
+	path := writeNamed(t, dir, "file.gz", "../evil.txt", time.Unix(1700000000, 0), []byte("data"))
+	p := newTestProgram(t, "-N", path)
+	p.decompressFile(path)
+	if p.status != exitOK {
+		t.Errorf("exit status %d", p.status)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "evil.txt")); err != nil || string(got) != "data" {
+		t.Errorf("evil.txt: %q, %v", got, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "evil.txt")); err != nil || info.ModTime().Unix() != 1700000000 {
+		t.Errorf("modification time not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outer, "evil.txt")); err == nil {
+		t.Error("the stored name escaped the directory")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"gunzip"
+)
+
+// listEntry is the JSON representation of a gzip member
+type listEntry struct {
+	File             string  `json:"file"`
+	Member           int     `json:"member"`
+	Offset           int64   `json:"offset"`
+	CompressedSize   int64   `json:"compressed_size"`
+	UncompressedSize uint64  `json:"uncompressed_size"`
+	Ratio            float64 `json:"ratio"`
+	Name             string  `json:"name,omitempty"`
+	MTime            uint32  `json:"mtime"`
+	OS               uint8   `json:"os"`
+	Crc32            uint32  `json:"crc32"`
+}
+
+func newListEntry(file string, idx int, m *gunzip.Member) listEntry {
+	var mtime, crc uint32
+	if t := m.Header.ModTime(); !t.IsZero() {
+		mtime = uint32(t.Unix())
+	}
+	if m.Footer != nil {
+		crc = m.Footer.Crc32
+	}
+	return listEntry{
+		File:             file,
+		Member:           idx + 1,
+		Offset:           m.Offset,
+		CompressedSize:   m.CompressedSize,
+		UncompressedSize: m.UncompressedSize,
+		Ratio:            m.Ratio(),
+		Name:             m.Header.Name(),
+		MTime:            mtime,
+		OS:               m.Header.OS(),
+		Crc32:            crc,
+	}
+}
+
+// listFiles prints the members of every file, as a table or as JSON
+func (p *program) listFiles(files []string) {
+	entries := make([]listEntry, 0)
+	for _, file := range files {
+		var members []gunzip.Member
+		var err error
+		if file == "-" {
+			if !p.checkStdin() {
+				continue
+			}
+			file = "stdin"
+			members, err = gunzip.List(os.Stdin)
+		} else {
+			inName, in, _, ok := p.openRegular(file)
+			if !ok {
+				continue
+			}
+			file = inName
+			members, err = gunzip.List(in)
+			in.Close()
+		}
+		if err = p.trailing(file, err); err != nil {
+			p.fail(file, err)
+			continue
+		}
+		for i := range members {
+			entries = append(entries, newListEntry(file, i, &members[i]))
+		}
+	}
+
+	if p.opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(entries)
+	} else {
+		printList(os.Stdout, entries)
+	}
+}
+
+func printList(w io.Writer, entries []listEntry) {
+	fmt.Fprintf(w, "%12s %14s %20s %7s %-19s %3s %s\n",
+		"member", "compressed", "uncompressed", "ratio", "mtime", "os", "name")
+	var compressed int64
+	var uncompressed uint64
+	for _, e := range entries {
+		mtime := "-"
+		if e.MTime != 0 {
+			mtime = time.Unix(int64(e.MTime), 0).Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%12s %14d %20d %6.1f%% %-19s %3d %s\n",
+			fmt.Sprintf("%s:%d", e.File, e.Member), e.CompressedSize, e.UncompressedSize, e.Ratio, mtime, e.OS, e.Name)
+		compressed += e.CompressedSize
+		uncompressed += e.UncompressedSize
+	}
+	if len(entries) > 1 {
+		total := gunzip.Member{CompressedSize: compressed, UncompressedSize: uncompressed}
+		fmt.Fprintf(w, "%12s %14d %20d %6.1f%%\n", "(totals)", compressed, uncompressed, total.Ratio())
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type options struct {
+	stdout  bool   // -c: write to standard output, keep input files
+	keep    bool   // -k: keep input files
+	name    bool   // -N: restore the stored file name and mtime
+	force   bool   // -f: overwrite existing output files
+	suffix  string // -S: suffix of compressed files
+	test    bool   // -t: test integrity, write nothing
+	jobs    int    // -j: number of goroutines used for decoding
+	list    bool   // -l: list members of compressed files
+	json    bool   // --json: list in JSON
+	help    bool   // -h: print usage
+	salvage bool   // --salvage: skip over damaged data instead of stopping
+	files   []string
+
+	untar     bool     // untar subcommand: extract tar archives
+	unzip     bool     // unzip subcommand: extract or list ZIP archives
+	directory string   // -C: extract into this directory
+	include   []string // --include: extract only paths matching these patterns
+}
+
+const usage = `Usage: %[1]s [OPTION]... [FILE]...
+  or:  %[1]s untar [OPTION]... [FILE]...
+  or:  %[1]s unzip [OPTION]... FILE...
+Decompress FILEs in place (by default), extract the tar archives they hold,
+or extract the ZIP archives FILEs.
+With no FILE, or when FILE is -, read standard input (except for unzip).
+
+  -c, --stdout      write on standard output, keep original files unchanged
+  -d, --decompress  decompress (always on; accepted for compatibility)
+  -f, --force       force overwrite of output file
+  -h, --help        give this help
+  -k, --keep        keep (don't delete) input files
+  -l, --list        list members of compressed files
+      --json        with -l, print the listing as JSON
+  -j, --jobs=N      decode with N goroutines (default 1)
+  -n, --no-name     do not restore the original name and timestamp (default)
+  -N, --name        restore the original name and timestamp stored in the
+                    header
+      --salvage     recover what can be decoded from a damaged file,
+                    skipping over damaged data; implies -k
+  -S, --suffix=SUF  use suffix SUF on compressed files
+  -t, --test        test compressed file integrity
+
+Options of untar and unzip:
+  -C, --directory=DIR    extract into DIR instead of the current directory
+      --include=PATTERN  extract only paths matching PATTERN or below a
+                         directory matching it; may be repeated
+  -l, --list             list the entries instead of extracting them
+`
+
+// parseArgs parses gzip style command line arguments, preceded by an optional
+// subcommand. Short options may be
+// combined (e.g. -kf) and options taking a value (-S, -j) accept it attached
+// or as the next argument.
+func parseArgs(args []string) (*options, error) {
+	opts := &options{suffix: ".gz", jobs: 1, directory: "."}
+	if len(args) > 0 && args[0] == "untar" {
+		opts.untar = true
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "unzip" {
+		opts.unzip = true
+		args = args[1:]
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			opts.files = append(opts.files, args[i+1:]...)
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			switch name {
+			case "stdout", "to-stdout":
+				opts.stdout = true
+			case "decompress", "uncompress":
+			case "force":
+				opts.force = true
+			case "help":
+				opts.help = true
+			case "keep":
+				opts.keep = true
+			case "name":
+				opts.name = true
+			case "no-name":
+				opts.name = false
+			case "list":
+				opts.list = true
+			case "json":
+				opts.json = true
+			case "salvage":
+				opts.salvage = true
+			case "suffix", "jobs", "directory", "include":
+				if !hasValue {
+					if i+1 == len(args) {
+						return nil, fmt.Errorf("option '--%s' requires an argument", name)
+					}
+					i++
+					value = args[i]
+				}
+				if err := opts.set(name, value); err != nil {
+					return nil, err
+				}
+			case "test":
+				opts.test = true
+			default:
+				return nil, fmt.Errorf("unrecognized option '%s'", arg)
+			}
+			continue
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			opts.files = append(opts.files, arg)
+			continue
+		}
+		for j := 1; j < len(arg); j++ {
+			switch arg[j] {
+			case 'c':
+				opts.stdout = true
+			case 'd':
+			case 'f':
+				opts.force = true
+			case 'h':
+				opts.help = true
+			case 'k':
+				opts.keep = true
+			case 'l':
+				opts.list = true
+			case 'N':
+				opts.name = true
+			case 'n':
+				opts.name = false
+			case 't':
+				opts.test = true
+			case 'S', 'j', 'C':
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 == len(args) {
+						return nil, fmt.Errorf("option requires an argument -- '%c'", arg[j])
+					}
+					i++
+					value = args[i]
+				}
+				if err := opts.set(shortValueOptions[arg[j]], value); err != nil {
+					return nil, err
+				}
+				j = len(arg)
+			default:
+				return nil, fmt.Errorf("invalid option -- '%c'", arg[j])
+			}
+		}
+	}
+	return opts, nil
+}
+
+// shortValueOptions maps short options taking a value to their long names
+var shortValueOptions = map[byte]string{'S': "suffix", 'j': "jobs", 'C': "directory"}
+
+// set assigns the value of an option that takes an argument, identified by
+// its long name
+func (opts *options) set(name string, value string) error {
+	switch name {
+	case "suffix":
+		if value == "" {
+			return fmt.Errorf("invalid suffix ''")
+		}
+		opts.suffix = value
+	case "jobs":
+		jobs, err := strconv.Atoi(value)
+		if err != nil || jobs < 1 {
+			return fmt.Errorf("invalid number of jobs '%s'", value)
+		}
+		opts.jobs = jobs
+	case "directory":
+		if value == "" {
+			return fmt.Errorf("invalid directory ''")
+		}
+		opts.directory = value
+	case "include":
+		if _, err := path.Match(value, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s'", value)
+		}
+		opts.include = append(opts.include, value)
+	}
+	return nil
+}
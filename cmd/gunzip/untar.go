@@ -0,0 +1,302 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// extractor writes the entries of a tar or ZIP archive below dir
+type extractor struct {
+	p    *program
+	dir  string
+	dirs []*tar.Header // directories whose mode and mtime are set last
+}
+
+// untarFile decodes a gzip file and extracts or lists the tar archive it
+// holds
+func (p *program) untarFile(name string) {
+	var reader io.Reader
+	if name == "-" {
+		if !p.checkStdin() {
+			return
+		}
+		name, reader = "stdin", os.Stdin
+	} else {
+		inName, in, _, ok := p.openRegular(name)
+		if !ok {
+			return
+		}
+		defer in.Close()
+		name, reader = inName, in
+	}
+
+	var x *extractor
+	if !p.opts.list {
+		var ok bool
+		if x, ok = p.newExtractor(); !ok {
+			return
+		}
+	}
+	decompressor := p.newDecompressor(reader)
+	if closer, ok := decompressor.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var err error
+	if p.opts.list {
+		err = p.listTar(tar.NewReader(decompressor))
+	} else {
+		err = x.extract(tar.NewReader(decompressor))
+	}
+	if err == nil {
+		// the tar reader stops at the end of archive blocks; the rest must
+		// still be decoded for the CRC32 and size in the footer to be checked
+		_, err = io.Copy(io.Discard, decompressor)
+		err = p.trailing(name, err)
+	}
+	if err != nil {
+		p.fail(name, err)
+	}
+}
+
+// listTar prints the entries of a tar archive selected by --include, in the
+// format of listZip
+func (p *program) listTar(archive *tar.Reader) error {
+	fmt.Printf("%12s %-16s %s\n", "length", "modified", "name")
+	var length int64
+	files := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !p.opts.matches(header.Name) {
+			continue
+		}
+		name := header.Name
+		if header.Typeflag == tar.TypeSymlink {
+			name += " -> " + header.Linkname
+		}
+		fmt.Printf("%12d %-16s %s\n", header.Size, header.ModTime.Format("2006-01-02 15:04"), name)
+		length += header.Size
+		files++
+	}
+	fmt.Printf("%12d %-16s %d files\n", length, "", files)
+	return nil
+}
+
+// newExtractor returns an extractor into the directory given with -C, which
+// must exist
+func (p *program) newExtractor() (*extractor, bool) {
+	if info, err := os.Stat(p.opts.directory); err != nil || !info.IsDir() {
+		if err == nil {
+			err = fmt.Errorf("not a directory")
+		}
+		p.fail(p.opts.directory, err)
+		return nil, false
+	}
+	return &extractor{p: p, dir: p.opts.directory}, true
+}
+
+func (x *extractor) extract(archive *tar.Reader) error {
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !x.p.opts.matches(header.Name) {
+			continue
+		}
+		target, err := x.target(header.Name)
+		if err != nil {
+			x.p.warn("%s: %v -- skipped", header.Name, err)
+			continue
+		}
+		if err := x.extractEntry(header, target, archive); err != nil {
+			return err
+		}
+	}
+
+	x.finish()
+	return nil
+}
+
+// finish sets directory attributes last and deepest first, so that read-only
+// directories can still be filled and their mtime is not disturbed
+func (x *extractor) finish() {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		header := x.dirs[i]
+		// a later entry may have put a symbolic link in place of the
+		// directory; os.Chmod and os.Chtimes would follow it
+		target, err := x.target(header.Name)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Lstat(target); err != nil || !info.IsDir() {
+			continue
+		}
+		if err := os.Chmod(target, header.FileInfo().Mode().Perm()); err != nil {
+			x.p.warn("%v", err)
+		}
+		if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+			x.p.warn("%v", err)
+		}
+	}
+}
+
+func (x *extractor) extractEntry(header *tar.Header, target string, data io.Reader) error {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		// an existing directory is kept, anything else in its place, such as
+		// a symbolic link, is replaced rather than followed
+		if info, err := os.Lstat(target); err == nil && info.IsDir() {
+			x.dirs = append(x.dirs, header)
+			return nil
+		}
+		if err := x.prepare(target); err != nil {
+			return err
+		}
+		if err := os.Mkdir(target, 0700); err != nil {
+			return err
+		}
+		x.dirs = append(x.dirs, header)
+		return nil
+	case tar.TypeReg:
+		if err := x.prepare(target); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, data)
+		if err == nil {
+			err = out.Close()
+		} else {
+			out.Close()
+		}
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(target, time.Now(), header.ModTime)
+	case tar.TypeSymlink:
+		link := filepath.FromSlash(header.Linkname)
+		if !localLink(header.Name, header.Linkname) {
+			x.p.warn("%s: symbolic link to %s leaves the extraction directory -- skipped", header.Name, header.Linkname)
+			return nil
+		}
+		if err := x.prepare(target); err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case tar.TypeLink:
+		source, err := x.target(header.Linkname)
+		if err != nil {
+			x.p.warn("%s: hard link to %s: %v -- skipped", header.Name, header.Linkname, err)
+			return nil
+		}
+		if err := x.prepare(target); err != nil {
+			return err
+		}
+		if err := os.Link(source, target); err != nil {
+			// the source may have been skipped or filtered out
+			x.p.warn("%v -- skipped", err)
+		}
+		return nil
+	default:
+		x.p.warn("%s: unsupported entry type '%c' -- skipped", header.Name, header.Typeflag)
+		return nil
+	}
+}
+
+// prepare creates the parent directories of target and removes whatever is
+// in its place, as tar does
+func (x *extractor) prepare(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// target maps an archive path below the extraction directory. It rejects
+// absolute paths and paths with ".." components, as well as paths that go
+// through a symbolic link, which could lead outside the directory.
+func (x *extractor) target(name string) (string, error) {
+	local := filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("path leaves the extraction directory")
+	}
+	target := filepath.Join(x.dir, local)
+	for parent := filepath.Dir(local); parent != "."; parent = filepath.Dir(parent) {
+		info, err := os.Lstat(filepath.Join(x.dir, parent))
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("path goes through symbolic link %s", filepath.ToSlash(parent))
+		}
+	}
+	return target, nil
+}
+
+// localLink reports whether the target of a symbolic link stored as name
+// stays below the extraction directory. Comparing the joined paths is not
+// enough, since ".." after a component that is itself a symbolic link leads
+// elsewhere than the text suggests: "p/q/.." is the parent of the target of
+// p/q. Only leading ".." components are accepted, which climb through the
+// real directories holding the link, and no more of them than its depth.
+func localLink(name, link string) bool {
+	if link == "" || path.IsAbs(link) || filepath.IsAbs(filepath.FromSlash(link)) {
+		return false
+	}
+	depth := 0
+	for _, part := range strings.Split(path.Dir(path.Clean(name)), "/") {
+		if part != "" && part != "." {
+			depth++
+		}
+	}
+	descended := false
+	for _, part := range strings.Split(filepath.ToSlash(link), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if descended || depth == 0 {
+				return false
+			}
+			depth--
+		default:
+			descended = true
+		}
+	}
+	return true
+}
+
+// matches reports whether an archive path is selected by the --include
+// patterns, either itself or through one of its parent directories
+func (opts *options) matches(name string) bool {
+	if len(opts.include) == 0 {
+		return true
+	}
+	name = path.Clean(name)
+	for _, pattern := range opts.include {
+		pattern = strings.TrimSuffix(pattern, "/")
+		for n := name; n != "." && n != "/"; n = path.Dir(n) {
+			if ok, _ := path.Match(pattern, n); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
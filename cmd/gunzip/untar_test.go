@@ -0,0 +1,252 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+type tarEntry struct {
+	header  tar.Header
+	content string
+}
+
+func file(name, content string) tarEntry {
+	return tarEntry{tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}, content}
+}
+
+func dir(name string, mode int64) tarEntry {
+	return tarEntry{tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: mode, ModTime: time.Unix(0, 0)}, ""}
+}
+
+func symlink(name, target string) tarEntry {
+	return tarEntry{tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}, ""}
+}
+
+// tarGz returns a gzip compressed tar archive of entries
+func tarGz(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := w.WriteHeader(&e.header); err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(e.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+// untarInto extracts archive into outer/dest and returns dest and the exit
+// status, checking that neither outer nor dest were modified through a link
+func untarInto(t *testing.T, archive []byte, args ...string) (string, int) {
+	t.Helper()
+	outer := t.TempDir()
+	dest := filepath.Join(outer, "dest")
+	if err := os.Mkdir(dest, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(outer, "archive.tgz")
+	if err := os.WriteFile(path, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := map[string]os.FileInfo{}
+	for _, d := range []string{outer, dest} {
+		before[d], _ = os.Stat(d)
+	}
+
+	p := newTestProgram(t, append(append([]string{"untar", "-C", dest}, args...), path)...)
+	p.untarFile(path)
+
+	for d, info := range before {
+		// extracting into dest updates its mtime, but never to that of an
+		// archive entry
+		after, err := os.Stat(d)
+		if err != nil || after.Mode() != info.Mode() || after.ModTime().Before(info.ModTime()) || (d == outer && !after.ModTime().Equal(info.ModTime())) {
+			t.Errorf("%s changed from %v %v to %v %v", d, info.Mode(), info.ModTime(), after.Mode(), after.ModTime())
+		}
+	}
+	entries, _ := os.ReadDir(outer)
+	for _, e := range entries {
+		if e.Name() != "dest" && e.Name() != "archive.tgz" {
+			t.Errorf("%s was created outside the destination", e.Name())
+		}
+	}
+	return dest, p.status
+}
+
+func TestUntar(t *testing.T) {
+	dest, status := untarInto(t, tarGz(t,
+		dir("dir/", 0750),
+		file("dir/file.txt", "content"),
+		symlink("dir/link", "file.txt"),
+		symlink("dir/up", "../top.txt"),
+		file("top.txt", "top"),
+	))
+	if status != exitOK {
+		t.Errorf("exit status %d", status)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "dir", "link")); err != nil || string(got) != "content" {
+		t.Errorf("dir/link: %q, %v", got, err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "dir", "up")); err != nil || string(got) != "top" {
+		t.Errorf("dir/up: %q, %v", got, err)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "dir")); err != nil || info.Mode().Perm() != 0750 || info.ModTime().Unix() != 0 {
+		t.Errorf("dir: %v, %v", info, err)
+	}
+}
+
+func TestUntarTraversal(t *testing.T) {
+	tests := map[string][]tarEntry{
+		"parent":        {file("../escape.txt", "x")},
+		"nested parent": {file("a/../../escape.txt", "x")},
+		"absolute":      {file("/tmp/escape.txt", "x")},
+		"link outside":  {symlink("link", "../escape.txt"), file("link", "x")},
+		"absolute link": {symlink("link", "/tmp"), file("link/escape.txt", "x")},
+		// p/q/.. is the parent of the target of p/q, here the parent of dest
+		"link chain": {
+			dir("p/", 0755), symlink("p/q", ".."), symlink("r", "p/q/.."),
+			dir("r/", 0700), file("r/escape.txt", "x"),
+		},
+		"through link": {symlink("up", "."), file("up/x.txt", "x"), dir("up/", 0700)},
+		// a directory replaced by a link must not have its mode set through it
+		"dir then link": {dir("d/", 0700), symlink("d", "."), file("other.txt", "x")},
+		"link then dir": {symlink("d", "."), dir("d/", 0700)},
+	}
+	for name, entries := range tests {
+		t.Run(name, func(t *testing.T) {
+			untarInto(t, tarGz(t, entries...))
+		})
+	}
+}
+
+func TestLocalLink(t *testing.T) {
+	tests := []struct {
+		name, link string
+		local      bool
+	}{
+		{"link", "file", true},
+		{"link", "dir/file", true},
+		{"link", ".", true},
+		{"link", "..", false},
+		{"link", "/etc/passwd", false},
+		{"link", "", false},
+		{"a/link", "..", true},
+		{"a/link", "../..", false},
+		{"a/b/link", "../../x", true},
+		{"a/b/link", "./../x", true},
+		{"a/link", "x/..", false},
+		{"r", "p/q/..", false},
+		{"a/../link", "..", false},
+	}
+	for _, test := range tests {
+		if got := localLink(test.name, test.link); got != test.local {
+			t.Errorf("localLink(%q, %q) = %v, want %v", test.name, test.link, got, test.local)
+		}
+	}
+}
+
+func TestUntarCorrupt(t *testing.T) {
+	archive := tarGz(t, file("file.txt", "content"))
+	badCrc := bytes.Clone(archive)
+	copy(badCrc[len(badCrc)-8:], []byte{0, 0, 0, 0})
+	badSize := bytes.Clone(archive)
+	badSize[len(badSize)-4]++
+	tests := []struct {
+		name   string
+		input  []byte
+		status int
+	}{
+		{"valid", archive, exitOK},
+		{"crc", badCrc, exitError},
+		{"size", badSize, exitError},
+		{"truncated", archive[:len(archive)-4], exitError},
+		{"trailing garbage", append(bytes.Clone(archive), "garbage"...), exitWarning},
+	}
+	for _, test := range tests {
+		for _, jobs := range []string{"1", "4"} {
+			t.Run(test.name+"/jobs="+jobs, func(t *testing.T) {
+				if _, status := untarInto(t, test.input, "-j", jobs); status != test.status {
+					t.Errorf("exit status %d, want %d", status, test.status)
+				}
+			})
+		}
+	}
+}
+
+func TestUntarWorkersExit(t *testing.T) {
+	// an archive that fails early, long before the end of the input
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"tar ", "header ", "block ", "entry ", "\n"}
+	var data []byte
+	for len(data) < 16<<20 {
+		data = append(data, words[rng.Intn(len(words))]...)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+
+	before := runtime.NumGoroutine()
+	if _, status := untarInto(t, buf.Bytes(), "-j", "4"); status != exitError {
+		t.Errorf("exit status %d, want %d", status, exitError)
+	}
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines left running", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// captureStdout returns what f writes to standard output
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+	f()
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUntarList(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "archive.tgz")
+	os.WriteFile(path, tarGz(t, file("a.txt", "12345"), symlink("link", "a.txt"), file("b/c.txt", "xy")), 0644)
+
+	p := newTestProgram(t, "untar", "-l", "-C", dir, path)
+	out := captureStdout(t, p.run)
+	if p.status != exitOK {
+		t.Errorf("exit status %d", p.status)
+	}
+	for _, want := range []string{"a.txt\n", "link -> a.txt\n", "b/c.txt\n", "7                  3 files\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("listing lacks %q:\n%s", want, out)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("-l extracted %d entries", len(entries)-1)
+	}
+}
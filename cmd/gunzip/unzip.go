@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gunzip"
+)
+
+// maximum length of the target of a symbolic link stored in a ZIP archive
+const maxZipLinkLen = 4096
+
+// unzipFile lists or extracts the entries of a ZIP archive
+func (p *program) unzipFile(name string) {
+	if name == "-" {
+		p.fail("stdin", errors.New("ZIP archives cannot be read from standard input"))
+		return
+	}
+	inName, in, info, ok := p.openRegular(name)
+	if !ok {
+		return
+	}
+	defer in.Close()
+	z, err := gunzip.NewZipReader(in, info.Size())
+	if err != nil {
+		p.fail(inName, err)
+		return
+	}
+	if p.opts.list {
+		p.listZip(z)
+		return
+	}
+
+	x, ok := p.newExtractor()
+	if !ok {
+		return
+	}
+	if err := x.extractZip(z); err != nil {
+		p.fail(inName, err)
+	}
+}
+
+// listZip prints the entries of a ZIP archive, as unzip -l does
+func (p *program) listZip(z *gunzip.ZipReader) {
+	fmt.Printf("%12s %12s %-16s %s\n", "length", "compressed", "modified", "name")
+	var length, compressed uint64
+	for _, e := range z.Entries {
+		fmt.Printf("%12d %12d %-16s %s\n", e.UncompressedSize, e.CompressedSize, e.Modified.Format("2006-01-02 15:04"), e.Name)
+		length += e.UncompressedSize
+		compressed += e.CompressedSize
+	}
+	fmt.Printf("%12d %12d %-16s %d files\n", length, compressed, "", len(z.Entries))
+}
+
+func (x *extractor) extractZip(z *gunzip.ZipReader) error {
+	for _, e := range z.Entries {
+		if !x.p.opts.matches(e.Name) {
+			continue
+		}
+		target, err := x.target(e.Name)
+		if err != nil {
+			x.p.warn("%s: %v -- skipped", e.Name, err)
+			continue
+		}
+		data, err := z.Open(e)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		header, err := zipHeader(e, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+		if err := x.extractEntry(header, target, data); err != nil {
+			return fmt.Errorf("%s: %w", e.Name, err)
+		}
+	}
+	x.finish()
+	return nil
+}
+
+// zipHeader describes a ZIP entry as a tar header, so that it is extracted
+// with the same checks as tar entries. The target of a symbolic link is read
+// from data.
+func zipHeader(e *gunzip.ZipEntry, data io.Reader) (*tar.Header, error) {
+	header := &tar.Header{Name: e.Name, ModTime: e.Modified, Typeflag: tar.TypeReg, Mode: 0644}
+	// Unix modes are stored in the upper half of the external attributes
+	mode := e.ExternalAttrs >> 16
+	if mode&0777 != 0 {
+		header.Mode = int64(mode & 0777)
+	}
+	switch {
+	case e.IsDir() || mode&0xF000 == 0x4000:
+		header.Typeflag = tar.TypeDir
+		if mode&0777 == 0 {
+			header.Mode = 0755
+		}
+	case mode&0xF000 == 0xA000:
+		header.Typeflag = tar.TypeSymlink
+		link, err := io.ReadAll(io.LimitReader(data, maxZipLinkLen+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(link) > maxZipLinkLen {
+			return nil, errors.New("symbolic link target too long")
+		}
+		header.Linkname = strings.TrimSuffix(string(link), "\x00")
+	}
+	return header, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	add := func(name string, mode fs.FileMode, content string) {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(mode)
+		fw, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(content))
+	}
+	add("dir/", fs.ModeDir|0755, "")
+	add("dir/file.txt", 0600, "file content")
+	add("link", fs.ModeSymlink|0777, "dir/file.txt")
+	add("../escape.txt", 0644, "outside")
+	add("evil", fs.ModeSymlink|0777, "../../etc/passwd")
+	add("dirlink", fs.ModeSymlink|0777, "dir")
+	add("dirlink/through.txt", 0644, "through the link")
+	w.Close()
+
+	root := t.TempDir()
+	archive := filepath.Join(root, "archive.zip")
+	os.WriteFile(archive, buf.Bytes(), 0644)
+	dir := filepath.Join(root, "out")
+	os.Mkdir(dir, 0755)
+
+	p := newTestProgram(t, "unzip", "-C", dir, archive)
+	p.unzipFile(archive)
+	if p.status != exitWarning {
+		t.Errorf("exit status %d, want %d for the skipped entries", p.status, exitWarning)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "dir", "file.txt")); err != nil || string(got) != "file content" {
+		t.Errorf("dir/file.txt: %q, %v", got, err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "dir", "file.txt")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("dir/file.txt mode: %v, %v", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dir, "link")); err != nil || link != "dir/file.txt" {
+		t.Errorf("link: %q, %v", link, err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "escape.txt")); err == nil {
+		t.Error("../escape.txt was extracted")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "evil")); err == nil {
+		t.Error("symbolic link evil was extracted")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "dir", "through.txt")); err == nil {
+		t.Error("dirlink/through.txt was extracted through a symbolic link")
+	}
+}
+
+func TestUnzipCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fw, _ := w.CreateHeader(&zip.FileHeader{Name: "file.txt", Method: zip.Store})
+	fw.Write([]byte("some stored content"))
+	w.Close()
+	data := buf.Bytes()
+	data[bytes.Index(data, []byte("some"))] ^= 1
+
+	root := t.TempDir()
+	archive := filepath.Join(root, "archive.zip")
+	os.WriteFile(archive, data, 0644)
+	p := newTestProgram(t, "unzip", "-C", root, archive)
+	p.unzipFile(archive)
+	if p.status != exitError {
+		t.Errorf("exit status %d, want %d", p.status, exitError)
+	}
+}
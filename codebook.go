@@ -1,4 +1,4 @@
-package main
+package gunzip
 
 type Codebook struct {
 	Book      []CodeLengthPair
@@ -14,13 +14,20 @@ const MAX_CODELENGTH = 15
 const MAX_LL_SYMBOL = 288
 
 func NewCodebook(lengths []uint32) (*Codebook, error) {
-	err := NewError(InvalidCodeLengths)
+	c := &Codebook{}
+	if err := c.build(lengths); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
 
+// build assigns the codes for lengths, reusing the storage of the codebook
+func (c *Codebook) build(lengths []uint32) error {
 	if len(lengths) == 0 || len(lengths) > int(MAX_LL_SYMBOL)+1 {
-		return nil, err
+		return NewError(InvalidCodeLengths)
 	}
 
-	book := make([]CodeLengthPair, len(lengths))
+	book := append(c.Book[:0], make([]CodeLengthPair, len(lengths))...)
 	var maxLen uint32
 
 	var blCount [MAX_CODELENGTH + 1]uint32
@@ -31,12 +38,21 @@ func NewCodebook(lengths []uint32) (*Codebook, error) {
 	}
 
 	if maxLen > MAX_CODELENGTH {
-		return nil, err
+		return NewError(InvalidCodeLengths)
+	}
+
+	// reject over-subscribed codes, whose code words would collide
+	blCount[0] = 0
+	left := 1
+	for bits := 1; bits <= MAX_CODELENGTH; bits++ {
+		left = left<<1 - int(blCount[bits])
+		if left < 0 {
+			return NewError(InvalidCodeLengths)
+		}
 	}
 
 	var nextCode [MAX_CODELENGTH + 1]uint32
 	var code uint32
-	blCount[0] = 0
 	for bits := uint32(1); bits <= maxLen; bits++ {
 		code = (code + blCount[bits-1]) << 1
 		nextCode[bits] = code
@@ -50,7 +66,9 @@ func NewCodebook(lengths []uint32) (*Codebook, error) {
 		}
 	}
 
-	return &Codebook{book, maxLen}, nil
+	c.Book = book
+	c.MaxLength = maxLen
+	return nil
 }
 
 func NewDefaultLLCodebook() *Codebook {
@@ -71,11 +89,28 @@ func NewDefaultLLCodebook() *Codebook {
 }
 
 func NewDefaultDistCodebook() *Codebook {
+	// codes 30 and 31 are only valid in Deflate64; deflate rejects them when
+	// looking up their extra bits
 	lengths := []uint32{
 		5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
 		5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
 		5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+		5, 5,
 	}
 	codebook, _ := NewCodebook(lengths)
 	return codebook
 }
+
+// IsComplete reports whether the code uses up the whole code space, or
+// consists of a single one bit code, which is all a valid encoder produces
+func (c *Codebook) IsComplete() bool {
+	var blCount [MAX_CODELENGTH + 1]int
+	for _, pair := range c.Book {
+		blCount[pair.Length] += 1
+	}
+	left := 1
+	for bits := 1; bits <= MAX_CODELENGTH; bits++ {
+		left = left<<1 - blCount[bits]
+	}
+	return left == 0 || (c.MaxLength == 1 && blCount[1] == 1)
+}
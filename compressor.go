@@ -0,0 +1,470 @@
+package gunzip
+
+import (
+	"io"
+)
+
+const (
+	NoCompression      = 0
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = -1
+)
+
+const historySize = 1 << 18
+const maxBlockTokens = 1 << 14
+const maxBlockBytes = 1 << 17
+const maxStoredBlock = 1<<16 - 1
+
+// bytes of lookahead the match finder needs before it can process a position
+const minLookahead = MAX_LENGTH + MIN_MATCH + 1
+
+const (
+	blockStored  = 0
+	blockFixed   = 1
+	blockDynamic = 2
+)
+
+var fixedLLEncoder = NewHuffmanEncoder(NewDefaultLLCodebook())
+var fixedDistEncoder = NewHuffmanEncoder(NewDefaultDistCodebook())
+
+// order in which code length code lengths are stored in a dynamic block
+var codeLengthOrder = []int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// Compressor produces a raw DEFLATE (RFC 1951) stream
+type Compressor struct {
+	writer     *BitWriter
+	level      int
+	finder     *MatchFinder
+	history    []uint8 // MAX_DISTANCE of history followed by data not yet compressed
+	pos        int     // next position in history to compress
+	blockStart int     // position in history where the current block begins
+	tokens     []CodeData
+	llFreq     []uint32
+	distFreq   []uint32
+
+	// pending match for lazy matching
+	prevLength     int
+	prevDistance   int
+	matchAvailable bool
+}
+
+func NewCompressor(writer io.Writer, level int) (*Compressor, error) {
+	if level == DefaultCompression {
+		level = 6
+	}
+	if level < NoCompression || level > BestCompression {
+		return nil, NewError(InvalidCompressionLevel)
+	}
+	return &Compressor{
+		writer:   NewBitWriter(writer),
+		level:    level,
+		finder:   NewMatchFinder(level),
+		history:  make([]uint8, 0, historySize),
+		tokens:   make([]CodeData, 0, maxBlockTokens),
+		llFreq:   make([]uint32, END_OF_BLOCK+len(SYMBOL2BITS_LENGTH)),
+		distFreq: make([]uint32, len(SYMBOL2BITS_DISTANCE)),
+	}, nil
+}
+
+// NewCompressorDict returns a Compressor whose matches may refer back into
+// dict, the data preceding the stream. Only the last MAX_DISTANCE bytes of
+// dict are used.
+func NewCompressorDict(writer io.Writer, level int, dict []byte) (*Compressor, error) {
+	c, err := NewCompressor(writer, level)
+	if err != nil {
+		return nil, err
+	}
+	c.setDictionary(dict)
+	return c, nil
+}
+
+// Reset discards the state of c so that it starts a new stream on writer with
+// the given preset dictionary, which may be nil
+func (c *Compressor) Reset(writer io.Writer, dict []byte) {
+	c.writer.Reset(writer)
+	c.finder.Reset()
+	c.history = c.history[:0]
+	c.pos = 0
+	c.blockStart = 0
+	c.tokens = c.tokens[:0]
+	clear(c.llFreq)
+	clear(c.distFreq)
+	c.prevLength = 0
+	c.prevDistance = 0
+	c.matchAvailable = false
+	c.setDictionary(dict)
+}
+
+func (c *Compressor) setDictionary(dict []byte) {
+	if len(dict) > MAX_DISTANCE {
+		dict = dict[len(dict)-MAX_DISTANCE:]
+	}
+	c.history = append(c.history, dict...)
+	if c.level != NoCompression {
+		for i := range dict {
+			c.finder.Insert(c.history, i)
+		}
+	}
+	c.pos = len(dict)
+	c.blockStart = len(dict)
+}
+
+func (c *Compressor) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(c.history) == cap(c.history) {
+			c.slide()
+		}
+		m := min(len(p), cap(c.history)-len(c.history))
+		c.history = append(c.history, p[:m]...)
+		p = p[m:]
+		c.deflate(false)
+		if c.writer.err != nil {
+			return n - len(p), c.writer.err
+		}
+	}
+	return n, nil
+}
+
+// Flush compresses all pending data and emits an empty stored block so that
+// the output so far ends on a byte boundary and can be fully decoded
+func (c *Compressor) Flush() error {
+	c.deflate(true)
+	c.writeBlock(false)
+	c.writeStored(nil, false)
+	return c.writer.Flush()
+}
+
+// Close compresses all pending data and terminates the stream with a final
+// block
+func (c *Compressor) Close() error {
+	c.deflate(true)
+	c.writeBlock(true)
+	return c.writer.Flush()
+}
+
+// slide drops history that can no longer be referenced, in multiples of
+// MAX_DISTANCE so that the match finder's chains stay aligned
+func (c *Compressor) slide() {
+	delta := min(c.pos-MAX_DISTANCE, c.blockStart)
+	delta -= delta % MAX_DISTANCE
+	if delta <= 0 {
+		return
+	}
+	copy(c.history, c.history[delta:])
+	c.history = c.history[:len(c.history)-delta]
+	c.pos -= delta
+	c.blockStart -= delta
+	c.finder.Rebase(delta)
+}
+
+// deflate turns history into tokens, leaving enough lookahead unless flushing
+func (c *Compressor) deflate(flush bool) {
+	end := len(c.history)
+	if !flush {
+		end -= minLookahead
+	}
+	if c.level == NoCompression {
+		c.pos = len(c.history)
+		if c.pos-c.blockStart >= maxBlockBytes {
+			c.writeBlock(false)
+		}
+		return
+	}
+	if c.finder.config.isLazy {
+		c.deflateLazy(end, flush)
+	} else {
+		c.deflateGreedy(end)
+	}
+}
+
+func (c *Compressor) deflateGreedy(end int) {
+	config := c.finder.config
+	for c.pos < end {
+		pos := c.pos
+		length, distance := c.finder.Find(c.history, pos, MIN_MATCH-1)
+		c.finder.Insert(c.history, pos)
+		if length >= MIN_MATCH {
+			c.addMatch(length, distance)
+			if length <= config.lazy {
+				for i := pos + 1; i < pos+length; i++ {
+					c.finder.Insert(c.history, i)
+				}
+			}
+			c.pos += length
+		} else {
+			c.addLiteral(c.history[pos])
+			c.pos++
+		}
+		if c.blockIsFull(c.pos) {
+			c.writeBlock(false)
+		}
+	}
+}
+
+func (c *Compressor) deflateLazy(end int, flush bool) {
+	config := c.finder.config
+	for c.pos < end {
+		pos := c.pos
+		length, distance := 0, 0
+		if c.prevLength < config.lazy {
+			length, distance = c.finder.Find(c.history, pos, max(c.prevLength, MIN_MATCH-1))
+		}
+		c.finder.Insert(c.history, pos)
+		if length == MIN_MATCH && distance > TOO_FAR {
+			length = 0
+		}
+
+		if c.prevLength >= MIN_MATCH && length <= c.prevLength {
+			// the match found at the previous position is at least as good
+			c.addMatch(c.prevLength, c.prevDistance)
+			matchEnd := pos - 1 + c.prevLength
+			for i := pos + 1; i < matchEnd; i++ {
+				c.finder.Insert(c.history, i)
+			}
+			c.pos = matchEnd
+			c.matchAvailable = false
+			c.prevLength = 0
+		} else {
+			if c.matchAvailable {
+				c.addLiteral(c.history[pos-1])
+			}
+			c.matchAvailable = true
+			c.prevLength, c.prevDistance = length, distance
+			c.pos++
+		}
+		if c.blockIsFull(c.tokenEnd()) {
+			c.writeBlock(false)
+		}
+	}
+	if flush && c.matchAvailable {
+		c.addLiteral(c.history[c.pos-1])
+		c.matchAvailable = false
+		c.prevLength = 0
+	}
+}
+
+// tokenEnd returns the position up to which history is covered by tokens
+func (c *Compressor) tokenEnd() int {
+	if c.matchAvailable {
+		return c.pos - 1
+	}
+	return c.pos
+}
+
+func (c *Compressor) blockIsFull(end int) bool {
+	return len(c.tokens) >= maxBlockTokens || end-c.blockStart >= maxBlockBytes
+}
+
+func (c *Compressor) addLiteral(value uint8) {
+	c.tokens = append(c.tokens, NewLiteral(value))
+	c.llFreq[value]++
+}
+
+func (c *Compressor) addMatch(length int, distance int) {
+	c.tokens = append(c.tokens, NewDictionary(uint32(length), uint32(distance)))
+	c.llFreq[END_OF_BLOCK+LengthSymbol(length)]++
+	c.distFreq[DistanceSymbol(distance)]++
+}
+
+// writeBlock emits the current tokens as a stored, fixed or dynamic block,
+// whichever is smallest. A non-final block is not written if empty.
+func (c *Compressor) writeBlock(final bool) {
+	end := c.tokenEnd()
+	data := c.history[c.blockStart:end]
+	if !final && len(data) == 0 {
+		return
+	}
+	c.llFreq[END_OF_BLOCK] = 1
+
+	storedBits := (len(data)/maxStoredBlock + 1) * 5 * 8
+	storedBits += len(data) * 8
+	if c.level == NoCompression {
+		c.writeStored(data, final)
+	} else {
+		extraBits := 0
+		for idx, freq := range c.llFreq[END_OF_BLOCK+1:] {
+			extraBits += int(freq) * int(SYMBOL2BITS_LENGTH[idx+1][0])
+		}
+		for idx, freq := range c.distFreq {
+			extraBits += int(freq) * int(SYMBOL2BITS_DISTANCE[idx][0])
+		}
+		fixedBits := 3 + extraBits + fixedLLEncoder.BitLength(c.llFreq) + fixedDistEncoder.BitLength(c.distFreq)
+
+		dynamic := newDynamicHeader(c.llFreq, c.distFreq)
+		dynamicBits := dynamic.bitLength() + extraBits +
+			dynamic.llEncoder.BitLength(c.llFreq) + dynamic.distEncoder.BitLength(c.distFreq)
+
+		if storedBits < min(fixedBits, dynamicBits) {
+			c.writeStored(data, final)
+		} else if fixedBits <= dynamicBits {
+			c.writeBlockHeader(final, blockFixed)
+			c.writeTokens(fixedLLEncoder, fixedDistEncoder)
+		} else {
+			c.writeBlockHeader(final, blockDynamic)
+			dynamic.write(c.writer)
+			c.writeTokens(dynamic.llEncoder, dynamic.distEncoder)
+		}
+	}
+
+	c.blockStart = end
+	c.tokens = c.tokens[:0]
+	clear(c.llFreq)
+	clear(c.distFreq)
+}
+
+func (c *Compressor) writeBlockHeader(final bool, blockType uint32) {
+	var bfinal uint32
+	if final {
+		bfinal = 1
+	}
+	c.writer.WriteBits(bfinal|blockType<<1, 3)
+}
+
+// writeStored emits data in stored blocks of at most maxStoredBlock bytes
+func (c *Compressor) writeStored(data []uint8, final bool) {
+	for {
+		n := min(len(data), maxStoredBlock)
+		c.writeBlockHeader(final && n == len(data), blockStored)
+		c.writer.ByteAlign()
+		c.writer.WriteBits(uint32(n), 16)
+		c.writer.WriteBits(uint32(^uint16(n)), 16)
+		c.writer.Write(data[:n])
+		data = data[n:]
+		if len(data) == 0 {
+			return
+		}
+	}
+}
+
+func (c *Compressor) writeTokens(llEncoder *HuffmanEncoder, distEncoder *HuffmanEncoder) {
+	w := c.writer
+	for _, token := range c.tokens {
+		if token.Tag == Literal {
+			llEncoder.Encode(w, int(token.Value))
+			continue
+		}
+		length := int(token.Length)
+		symbol := LengthSymbol(length)
+		llEncoder.Encode(w, END_OF_BLOCK+symbol)
+		extra := SYMBOL2BITS_LENGTH[symbol]
+		w.WriteBits(uint32(length)-extra[1], int(extra[0]))
+
+		distance := int(token.Distance)
+		symbol = DistanceSymbol(distance)
+		distEncoder.Encode(w, symbol)
+		extra = SYMBOL2BITS_DISTANCE[symbol]
+		w.WriteBits(uint32(distance)-extra[1], int(extra[0]))
+	}
+	llEncoder.Encode(w, END_OF_BLOCK)
+}
+
+// dynamicHeader holds the Huffman codes of a dynamic block and the run length
+// encoded code lengths that describe them
+type dynamicHeader struct {
+	llEncoder   *HuffmanEncoder
+	distEncoder *HuffmanEncoder
+	hlit, hdist int
+	hclen       int
+	clEncoder   *HuffmanEncoder
+	clLengths   []uint32
+	clFreq      []uint32
+	clSymbols   []codeLengthSymbol
+}
+
+type codeLengthSymbol struct {
+	symbol uint32
+	extra  uint32 // value of the extra bits of symbols 16, 17 and 18
+}
+
+// extra bits of the code length symbols 16, 17 and 18
+var codeLengthExtraBits = [19]int{16: 2, 17: 3, 18: 7}
+
+func newDynamicHeader(llFreq []uint32, distFreq []uint32) *dynamicHeader {
+	llLengths := BuildCodeLengths(llFreq, MAX_CODELENGTH)
+	distLengths := BuildCodeLengths(distFreq, MAX_CODELENGTH)
+	llCodebook, _ := NewCodebook(llLengths)
+	distCodebook, _ := NewCodebook(distLengths)
+
+	h := &dynamicHeader{
+		llEncoder:   NewHuffmanEncoder(llCodebook),
+		distEncoder: NewHuffmanEncoder(distCodebook),
+		hlit:        len(llLengths),
+		hdist:       len(distLengths),
+		clFreq:      make([]uint32, len(codeLengthOrder)),
+	}
+	for h.hlit > END_OF_BLOCK+1 && llLengths[h.hlit-1] == 0 {
+		h.hlit--
+	}
+	for h.hdist > 1 && distLengths[h.hdist-1] == 0 {
+		h.hdist--
+	}
+
+	lengths := append(append([]uint32{}, llLengths[:h.hlit]...), distLengths[:h.hdist]...)
+	emit := func(symbol uint32, extra uint32) {
+		h.clSymbols = append(h.clSymbols, codeLengthSymbol{symbol, extra})
+		h.clFreq[symbol]++
+	}
+	for i := 0; i < len(lengths); {
+		length := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == length {
+			run++
+		}
+		i += run
+		if length == 0 {
+			for run >= 11 {
+				n := min(run, 138)
+				emit(18, uint32(n-11))
+				run -= n
+			}
+			if run >= 3 {
+				emit(17, uint32(run-3))
+				run = 0
+			}
+		} else {
+			emit(length, 0)
+			run--
+			for run >= 3 {
+				n := min(run, 6)
+				emit(16, uint32(n-3))
+				run -= n
+			}
+		}
+		for ; run > 0; run-- {
+			emit(length, 0)
+		}
+	}
+
+	h.clLengths = BuildCodeLengths(h.clFreq, 7)
+	clCodebook, _ := NewCodebook(h.clLengths)
+	h.clEncoder = NewHuffmanEncoder(clCodebook)
+	h.hclen = len(codeLengthOrder)
+	for h.hclen > 4 && h.clLengths[codeLengthOrder[h.hclen-1]] == 0 {
+		h.hclen--
+	}
+	return h
+}
+
+// bitLength returns the size of the block header in bits
+func (h *dynamicHeader) bitLength() int {
+	n := 3 + 5 + 5 + 4 + 3*h.hclen + h.clEncoder.BitLength(h.clFreq)
+	for symbol, freq := range h.clFreq {
+		n += int(freq) * codeLengthExtraBits[symbol]
+	}
+	return n
+}
+
+func (h *dynamicHeader) write(w *BitWriter) {
+	w.WriteBits(uint32(h.hlit-257), 5)
+	w.WriteBits(uint32(h.hdist-1), 5)
+	w.WriteBits(uint32(h.hclen-4), 4)
+	for _, symbol := range codeLengthOrder[:h.hclen] {
+		w.WriteBits(h.clLengths[symbol], 3)
+	}
+	for _, cl := range h.clSymbols {
+		h.clEncoder.Encode(w, int(cl.symbol))
+		w.WriteBits(cl.extra, codeLengthExtraBits[cl.symbol])
+	}
+}
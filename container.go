@@ -0,0 +1,157 @@
+package gunzip
+
+import (
+	"encoding/binary"
+	"hash/adler32"
+	"io"
+)
+
+// FDICT is the zlib FLG bit announcing a preset dictionary
+const FDICT = 0x20
+
+// Container describes the framing around DEFLATE data: gzip (RFC 1952), zlib
+// (RFC 1950) or none at all
+type Container interface {
+	// ReadHeader reads the framing before the compressed data. It returns the
+	// gzip header, if the format has one, and the preset dictionary that
+	// primes the history.
+	ReadHeader(reader BitRead) (*Header, []uint8, error)
+	// ReadFooter reads the framing after the compressed data
+	ReadFooter(reader BitRead) (*Footer, error)
+	// NewChecksum returns the checksum the footer is verified against
+	NewChecksum() Checksum
+	// Verify checks a footer against the checksum of the decoded data
+	Verify(footer *Footer, checksum Checksum) error
+	// Multimember reports whether further members may follow the first
+	Multimember() bool
+}
+
+// GzipContainer is the gzip format, which may hold several members. The
+// CRC16 of headers with FHCRC set is verified unless IgnoreHeaderCrc is set.
+type GzipContainer struct {
+	IgnoreHeaderCrc bool
+}
+
+func (c GzipContainer) ReadHeader(reader BitRead) (*Header, []uint8, error) {
+	header, err := readHeader(reader, !c.IgnoreHeaderCrc)
+	return header, nil, err
+}
+
+func (GzipContainer) ReadFooter(reader BitRead) (*Footer, error) {
+	return ReadFooter(reader)
+}
+
+func (GzipContainer) NewChecksum() Checksum {
+	return NewCrc32()
+}
+
+func (GzipContainer) Verify(footer *Footer, checksum Checksum) error {
+	return footer.Verify(checksum)
+}
+
+func (GzipContainer) Multimember() bool {
+	return true
+}
+
+// ZlibContainer is the zlib format. Dict is the preset dictionary for streams
+// with FDICT set. The Adler-32 of a zlib stream is stored in Footer.Crc32.
+type ZlibContainer struct {
+	Dict []uint8
+}
+
+func (c ZlibContainer) ReadHeader(reader BitRead) (*Header, []uint8, error) {
+	var cmf [2]byte
+	if err := reader.ReadExact(cmf[:]); err != nil {
+		return nil, nil, err
+	}
+	if cmf[0]&0x0f != DEFLATE || cmf[0]>>4 > 7 || binary.BigEndian.Uint16(cmf[:])%31 != 0 {
+		return nil, nil, NewError(InvalidZlibHeader)
+	}
+	if cmf[1]&FDICT == 0 {
+		return nil, nil, nil
+	}
+	var dictID uint32
+	if err := binary.Read(reader, binary.BigEndian, &dictID); err != nil {
+		return nil, nil, err
+	}
+	if c.Dict == nil || adler32.Checksum(c.Dict) != dictID {
+		return nil, nil, NewError(DictionaryMismatch)
+	}
+	return nil, c.Dict, nil
+}
+
+func (ZlibContainer) ReadFooter(reader BitRead) (*Footer, error) {
+	var f Footer
+	err := binary.Read(reader, binary.BigEndian, &f.Crc32)
+	return &f, err
+}
+
+func (ZlibContainer) NewChecksum() Checksum {
+	return NewAdler32()
+}
+
+func (ZlibContainer) Verify(footer *Footer, checksum Checksum) error {
+	if checksum.Checksum() != footer.Crc32 {
+		return NewError(ChecksumMismatch)
+	}
+	checksum.ResetLen()
+	return nil
+}
+
+func (ZlibContainer) Multimember() bool {
+	return false
+}
+
+// RawContainer is bare DEFLATE data with no framing or checksum, optionally
+// compressed against a preset dictionary
+type RawContainer struct {
+	Dict []uint8
+}
+
+func (c RawContainer) ReadHeader(reader BitRead) (*Header, []uint8, error) {
+	return nil, c.Dict, nil
+}
+
+func (RawContainer) ReadFooter(reader BitRead) (*Footer, error) {
+	return nil, nil
+}
+
+func (RawContainer) NewChecksum() Checksum {
+	return NewCrc32()
+}
+
+func (RawContainer) Verify(footer *Footer, checksum Checksum) error {
+	return nil
+}
+
+func (RawContainer) Multimember() bool {
+	return false
+}
+
+// NewZlibReader returns a Decompressor that reads a zlib stream from reader
+func NewZlibReader(reader io.Reader) *Decompressor {
+	return NewDecompressorContainer(reader, ZlibContainer{})
+}
+
+// NewZlibReaderDict is like NewZlibReader but decodes streams compressed with
+// the preset dictionary dict
+func NewZlibReaderDict(reader io.Reader, dict []uint8) *Decompressor {
+	return NewDecompressorContainer(reader, ZlibContainer{dict})
+}
+
+// NewRawReader returns a Decompressor that reads raw DEFLATE data from reader
+func NewRawReader(reader io.Reader) *Decompressor {
+	return NewDecompressorContainer(reader, RawContainer{})
+}
+
+// NewRawReaderDict is like NewRawReader but decodes data compressed with the
+// preset dictionary dict
+func NewRawReaderDict(reader io.Reader, dict []uint8) *Decompressor {
+	return NewDecompressorContainer(reader, RawContainer{dict})
+}
+
+// NewDeflate64Reader returns a Decompressor that reads raw Deflate64 data, as
+// stored in ZIP entries of method 9, from reader
+func NewDeflate64Reader(reader io.Reader) *Decompressor {
+	return NewDecompressorFormat(reader, RawContainer{}, Deflate64Format)
+}
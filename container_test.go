@@ -0,0 +1,103 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"io"
+	"testing"
+)
+
+// zlibData compresses data into a zlib stream with compress/zlib, against
+// the preset dictionary dict if it is not nil
+func zlibData(t *testing.T, data []byte, dict []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zlib.NewWriterLevelDict(&buf, zlib.DefaultCompression, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestZlib(t *testing.T) {
+	for name, data := range testInputs() {
+		got, err := io.ReadAll(NewZlibReader(bytes.NewReader(zlibData(t, data, nil))))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: output mismatch", name)
+		}
+	}
+}
+
+func TestZlibDict(t *testing.T) {
+	dict := []byte("a preset dictionary of words that the data repeats")
+	data := bytes.Repeat([]byte("the data repeats words of a preset dictionary "), 10)
+	input := zlibData(t, data, dict)
+
+	got, err := io.ReadAll(NewZlibReaderDict(bytes.NewReader(input), dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("output mismatch")
+	}
+	for name, dict := range map[string][]byte{"no": nil, "wrong": []byte("another dictionary")} {
+		if _, err := io.ReadAll(NewZlibReaderDict(bytes.NewReader(input), dict)); !errors.Is(err, DictionaryMismatch) {
+			t.Errorf("%s dictionary: got %v, want %v", name, err, DictionaryMismatch)
+		}
+	}
+}
+
+func TestZlibErrors(t *testing.T) {
+	valid := zlibData(t, []byte("zlib data"), nil)
+	badAdler := bytes.Clone(valid)
+	badAdler[len(badAdler)-1] ^= 1
+	badCheck := bytes.Clone(valid)
+	badCheck[1] ^= 1
+	// headers with a valid check
+	badWindow := append([]byte{0x88, 0x1c}, valid[2:]...)
+	badMethod := append([]byte{0x79, 0x18}, valid[2:]...)
+	for _, test := range []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"adler-32", badAdler, ChecksumMismatch},
+		{"header check", badCheck, InvalidZlibHeader},
+		{"window size", badWindow, InvalidZlibHeader},
+		{"method", badMethod, InvalidZlibHeader},
+		{"truncated footer", valid[:len(valid)-2], io.ErrUnexpectedEOF},
+	} {
+		_, err := io.ReadAll(NewZlibReader(bytes.NewReader(test.input)))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestRawDict(t *testing.T) {
+	dict := []byte("raw deflate data against a dictionary")
+	data := bytes.Repeat([]byte("deflate data against a raw dictionary "), 10)
+	var buf bytes.Buffer
+	w, _ := flate.NewWriterDict(&buf, flate.DefaultCompression, dict)
+	w.Write(data)
+	w.Close()
+
+	got, err := io.ReadAll(NewRawReaderDict(bytes.NewReader(buf.Bytes()), dict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("output mismatch")
+	}
+	// the matches refer to the dictionary, so they cannot be resolved without it
+	if _, err := io.ReadAll(NewRawReader(bytes.NewReader(buf.Bytes()))); !errors.Is(err, DistanceTooMuch) {
+		t.Errorf("without the dictionary: %v", err)
+	}
+}
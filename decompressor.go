@@ -1,23 +1,75 @@
-package main
+// Package gunzip implements a decompressor for gzip (RFC 1952) streams, as
+// well as zlib (RFC 1950) and raw DEFLATE (RFC 1951) data.
+package gunzip
 
 import (
 	"io"
 )
 
 type Decompressor struct {
-	producer *Producer
-	buf      []uint8
-	begin    int
-	checksum Checksum
+	bitreader *BitReader
+	producer  *Producer
+	container Container
+	buf       []uint8
+	begin     int
+	checksum  Checksum
+	header    *Header
 }
 
 func NewDecompressor(reader io.Reader) *Decompressor {
+	return NewDecompressorContainer(reader, GzipContainer{})
+}
+
+// NewDecompressorContainer returns a Decompressor for DEFLATE data framed as
+// described by container
+func NewDecompressorContainer(reader io.Reader, container Container) *Decompressor {
+	return NewDecompressorFormat(reader, container, DeflateFormat)
+}
+
+// NewDecompressorFormat returns a Decompressor for data in the given format,
+// such as Deflate64Format
+func NewDecompressorFormat(reader io.Reader, container Container, format *Format) *Decompressor {
 	bitreader := NewBitReader(reader)
-	producer := NewProducer(bitreader)
-	checksum := NewCrc32()
-	return &Decompressor{producer, make([]uint8, 0), 0, checksum}
+	producer := NewProducerFormat(bitreader, container, format)
+	// the data of a produce is consumed before the next is decoded
+	producer.borrow = true
+	checksum := container.NewChecksum()
+	return &Decompressor{bitreader, producer, container, make([]uint8, 0), 0, checksum, nil}
 }
 
+// NewReader returns a Decompressor that reads gzip data from reader.
+// It is the preferred entry point for callers of this package.
+func NewReader(reader io.Reader) *Decompressor {
+	return NewDecompressor(reader)
+}
+
+// Reset discards the state of d so that it decodes a new stream from reader,
+// reusing its buffers, window and tables. The container and limits are kept.
+func (d *Decompressor) Reset(reader io.Reader) {
+	d.bitreader.Reset(reader)
+	d.producer.Reset(d.bitreader)
+	d.checksum.Reset()
+	d.buf = d.buf[:0]
+	d.begin = 0
+	d.header = nil
+}
+
+// SetLimits bounds the output, the number of members and the expansion
+// ratio. Once a limit is crossed, Read fails with an error of kind
+// LimitExceeded.
+func (d *Decompressor) SetLimits(limits Limits) {
+	d.producer.SetLimits(limits)
+}
+
+// Header returns the header of the member the data returned by the last Read
+// came from, or nil before the first member or if the container has no
+// header. A single Read never returns data of more than one gzip member.
+func (d *Decompressor) Header() *Header {
+	return d.header
+}
+
+// fillBuffer decodes the next chunk of data. It returns 0 at the end of each
+// member.
 func (d *Decompressor) fillBuffer() (int, error) {
 	for {
 		produce, err := d.producer.Next()
@@ -25,19 +77,17 @@ func (d *Decompressor) fillBuffer() (int, error) {
 			return 0, err
 		}
 		if produce == nil {
-			return 0, nil
+			return 0, io.EOF
 		}
 		if produce.Tag == ProduceHeader {
-			// nothing to do
+			// members in the legacy formats leave data without a footer
+			d.checksum.Reset()
+			d.header = produce.Head
 		} else if produce.Tag == ProduceFooter {
-			footer := produce.Foot
-			if d.checksum.Checksum() != footer.Crc32 {
-				return 0, NewError(ChecksumMismatch)
+			if err := d.container.Verify(produce.Foot, d.checksum); err != nil {
+				return 0, d.producer.annotate(err)
 			}
-			if d.checksum.Len()&0xFFFFFFFF != int(footer.Size) {
-				return 0, NewError(SizeMismatch)
-			}
-			d.checksum.ResetLen()
+			return 0, nil
 		} else if produce.Tag == ProduceData {
 			xs := produce.Data
 			if len(xs) == 0 {
@@ -67,10 +117,36 @@ func (d *Decompressor) Read(buf []uint8) (int, error) {
 		if err != nil {
 			return nbytes, err
 		}
-		if filled == 0 {
+		if filled == 0 && nbytes > 0 {
 			break
 		}
 	}
 
 	return nbytes, nil
 }
+
+// WriteTo implements io.WriterTo. Decoded data is written to writer straight
+// from the window it is decoded into.
+func (d *Decompressor) WriteTo(writer io.Writer) (int64, error) {
+	total := int64(0)
+	for {
+		if d.begin < len(d.buf) {
+			n, err := writer.Write(d.buf[d.begin:])
+			total += int64(n)
+			d.begin += n
+			if err != nil {
+				return total, err
+			}
+			if d.begin < len(d.buf) {
+				return total, io.ErrShortWrite
+			}
+		}
+		_, err := d.fillBuffer()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
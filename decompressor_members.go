@@ -0,0 +1,338 @@
+package gunzip
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync/atomic"
+)
+
+// a member producing more than this is streamed by the reader instead of
+// being decoded ahead by a worker, which bounds the memory held by the
+// members in flight to 2*workers*maxMemberOutput
+const maxMemberOutput = 4 << 20
+
+// IsMultiMember looks this far into the input for a second member
+const multiMemberProbe = 32 << 20
+
+// size of the blocks read when searching for member headers
+const scanBlockSize = 64 << 10
+
+// DecompressorMultiMember decodes a gzip file made of many independent
+// members, such as BGZF or concatenated logs, by decoding members
+// concurrently on a pool of workers. Member boundaries are taken from the
+// BGZF BC subfield when present and are otherwise guessed by searching for
+// gzip headers; a member is used only if it starts exactly where the previous
+// one ended, and members that cannot be decoded ahead are streamed.
+//
+// The workers exit once Read returns io.EOF or an error. A reader abandoned
+// before that must be closed with Close.
+type DecompressorMultiMember struct {
+	input   io.ReaderAt
+	size    int64
+	workers int
+	jobs    chan *memberJob
+	queue   []*memberJob // scheduled members in input order
+	scan    int64        // offset from which to look for the next member
+	pos     int64        // offset of the next member to output
+	members int
+	done    bool  // the input ended or decoding failed
+	err     error // returned instead of io.EOF once done
+	stopped bool  // the workers were told to exit
+	closed  bool
+
+	// state of a member streamed by the reader itself
+	bitreader *BitReader
+	producer  *Producer
+
+	buf      []uint8
+	begin    int
+	checksum Checksum
+}
+
+type memberJob struct {
+	start  int64
+	end    int64
+	data   []uint8
+	ok     bool
+	cancel atomic.Bool
+	done   chan struct{}
+}
+
+// NewDecompressorMultiMember returns a DecompressorMultiMember reading size
+// bytes of gzip data from input with the given number of workers, or one per
+// CPU if workers < 1
+func NewDecompressorMultiMember(input io.ReaderAt, size int64, workers int) *DecompressorMultiMember {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	d := &DecompressorMultiMember{
+		input:    input,
+		size:     size,
+		workers:  workers,
+		jobs:     make(chan *memberJob, 4*workers),
+		buf:      make([]uint8, 0),
+		checksum: NewCrc32(),
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// IsMultiMember reports whether DecompressorMultiMember can find the member
+// boundaries of the size bytes of gzip data in input: the first member is
+// BGZF, or another member that decodes to its footer starts within the first
+// 32 MiB. Inputs made of a few large members are better decoded with
+// DecompressorParallel.
+func IsMultiMember(input io.ReaderAt, size int64) bool {
+	header, err := readGzipHeader(NewBitReader(io.NewSectionReader(input, 0, size)))
+	if err != nil {
+		return false
+	}
+	if _, ok := BGZFBlockSize(header); ok {
+		return true
+	}
+	// members that do not end within the probe fail to decode
+	d := &DecompressorMultiMember{input: input, size: min(size, multiMemberProbe)}
+	for offset := int64(1); ; offset = d.scan {
+		start := d.nextMember(offset)
+		if start < 0 {
+			return false
+		}
+		job := &memberJob{start: start}
+		if d.decodeMember(job); job.ok {
+			return true
+		}
+	}
+}
+
+func (d *DecompressorMultiMember) work() {
+	for job := range d.jobs {
+		if !job.cancel.Load() {
+			d.decodeMember(job)
+		}
+		close(job.done)
+	}
+}
+
+// Close stops the workers. It does not close the input.
+func (d *DecompressorMultiMember) Close() error {
+	d.closed = true
+	d.stop()
+	return nil
+}
+
+// stop cancels the members in flight and lets the workers exit
+func (d *DecompressorMultiMember) stop() {
+	if d.stopped {
+		return
+	}
+	d.stopped = true
+	for _, job := range d.queue {
+		job.cancel.Store(true)
+	}
+	d.queue = nil
+	close(d.jobs)
+}
+
+// decodeMember decodes and verifies the member starting at job.start
+func (d *DecompressorMultiMember) decodeMember(job *memberJob) {
+	bitreader := NewBitReader(io.NewSectionReader(d.input, job.start, d.size-job.start))
+	producer := NewProducer(bitreader)
+	producer.borrow = true
+	checksum := NewCrc32()
+	for !job.cancel.Load() {
+		produce, err := producer.Next()
+		if err != nil || produce == nil {
+			return
+		}
+		if produce.Tag == ProduceData {
+			if len(job.data)+len(produce.Data) > maxMemberOutput {
+				job.data = nil
+				return
+			}
+			checksum.Update(produce.Data)
+			job.data = append(job.data, produce.Data...)
+		} else if produce.Tag == ProduceFooter {
+			if produce.Foot.Verify(checksum) != nil {
+				job.data = nil
+				return
+			}
+			job.end = job.start + bitreader.Offset()
+			job.ok = true
+			return
+		}
+	}
+}
+
+// schedule queues members following the current position until every
+// worker has a couple of them ahead, and drops those already passed
+func (d *DecompressorMultiMember) schedule() {
+	for len(d.queue) > 0 && d.queue[0].start < d.pos {
+		d.queue[0].cancel.Store(true)
+		d.queue = d.queue[1:]
+	}
+	if d.scan < d.pos {
+		d.scan = d.pos
+	}
+	for len(d.queue) < 2*d.workers && d.scan < d.size {
+		start := d.nextMember(d.scan)
+		if start < 0 {
+			d.scan = d.size
+			break
+		}
+		job := &memberJob{start: start, done: make(chan struct{})}
+		d.queue = append(d.queue, job)
+		d.jobs <- job
+	}
+}
+
+// nextMember returns the offset of the first plausible member header at or
+// after offset, and sets the offset to continue scanning from
+func (d *DecompressorMultiMember) nextMember(offset int64) int64 {
+	buf := make([]uint8, scanBlockSize+2)
+	for offset < d.size {
+		n, _ := d.input.ReadAt(buf, offset)
+		if n < 3 {
+			return -1
+		}
+		idx := bytes.Index(buf[:n], []uint8{ID1, ID2, DEFLATE})
+		if idx < 0 {
+			offset += int64(max(n-2, 1))
+			continue
+		}
+		start := offset + int64(idx)
+		reader := NewBitReader(io.NewSectionReader(d.input, start, d.size-start))
+		header, err := readGzipHeader(reader)
+		if err != nil {
+			offset = start + 1
+			continue
+		}
+		if blockSize, ok := BGZFBlockSize(header); ok {
+			d.scan = start + int64(blockSize)
+		} else {
+			d.scan = start + 1
+		}
+		return start
+	}
+	return -1
+}
+
+func (d *DecompressorMultiMember) fillBuffer() (int, error) {
+	n, err := d.decodeNext()
+	if err != nil && !d.done {
+		// decoding errors are final
+		d.done, d.err = true, err
+	}
+	if d.done {
+		d.stop()
+	}
+	return n, err
+}
+
+func (d *DecompressorMultiMember) decodeNext() (int, error) {
+	if d.closed {
+		return 0, io.ErrClosedPipe
+	}
+	for {
+		if d.done {
+			if d.err != nil {
+				return 0, d.err
+			}
+			return 0, io.EOF
+		}
+		if d.producer != nil {
+			n, err := d.stream()
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+		if d.pos >= d.size {
+			if d.members == 0 {
+				return 0, NewError(EmptyInput)
+			}
+			d.done = true
+			continue
+		}
+
+		d.schedule()
+		if len(d.queue) > 0 && d.queue[0].start == d.pos {
+			job := d.queue[0]
+			d.queue = d.queue[1:]
+			<-job.done
+			if job.ok {
+				d.pos = job.end
+				d.members++
+				if len(job.data) == 0 {
+					continue
+				}
+				d.buf = job.data
+				d.begin = 0
+				return len(d.buf), nil
+			}
+		}
+		// no member decoded ahead from here: stream it, unless nothing but
+		// padding or garbage is left
+		d.bitreader = NewBitReader(io.NewSectionReader(d.input, d.pos, d.size-d.pos))
+		if d.members > 0 {
+			member, err := memberFollows(d.bitreader)
+			if e, ok := err.(*Error); ok {
+				e.Member, e.BitOffset = d.members, e.BitOffset+d.pos*8
+			}
+			if !member {
+				d.done, d.err = true, err
+				continue
+			}
+		}
+		d.producer = NewProducer(d.bitreader)
+	}
+}
+
+// stream decodes the next piece of the member being streamed
+func (d *DecompressorMultiMember) stream() (int, error) {
+	produce, err := d.producer.Next()
+	if err != nil {
+		return 0, err
+	}
+	if produce.Tag == ProduceData {
+		d.checksum.Update(produce.Data)
+		d.buf = produce.Data
+		d.begin = 0
+		return len(d.buf), nil
+	} else if produce.Tag == ProduceFooter {
+		if err := produce.Foot.Verify(d.checksum); err != nil {
+			return 0, err
+		}
+		d.pos += d.bitreader.Offset()
+		d.members++
+		d.producer = nil
+		d.bitreader = nil
+	}
+	return 0, nil
+}
+
+func (d *DecompressorMultiMember) Read(buf []uint8) (int, error) {
+	nbytes := 0
+	idx := 0
+	for {
+		n := min(len(buf[idx:]), len(d.buf[d.begin:]))
+		copy(buf[idx:idx+n], d.buf[d.begin:d.begin+n])
+		idx += n
+		nbytes += n
+		d.begin += n
+		if idx == len(buf) {
+			break
+		}
+		filled, err := d.fillBuffer()
+		if err != nil {
+			return nbytes, err
+		}
+		if filled == 0 {
+			break
+		}
+	}
+
+	return nbytes, nil
+}
@@ -0,0 +1,149 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// bgzfData compresses data into BGZF members of at most 64 KiB of input,
+// each carrying its size in the BC subfield, followed by the empty end of
+// file member
+func bgzfData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var out []byte
+	for {
+		n := min(len(data), 0xff00)
+		var deflate bytes.Buffer
+		w, _ := flate.NewWriter(&deflate, flate.DefaultCompression)
+		w.Write(data[:n])
+		w.Close()
+		header := []byte{ID1, ID2, DEFLATE, FEXTRA, 0, 0, 0, 0, 0, 255, 6, 0, 'B', 'C', 2, 0, 0, 0}
+		size := len(header) + deflate.Len() + 8
+		binary.LittleEndian.PutUint16(header[16:], uint16(size-1))
+		out = append(out, header...)
+		out = append(out, deflate.Bytes()...)
+		out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(data[:n]))
+		out = binary.LittleEndian.AppendUint32(out, uint32(n))
+		data = data[n:]
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+// concatenated compresses pieces of data of the given size as separate
+// members
+func concatenated(t *testing.T, data []byte, size int) []byte {
+	t.Helper()
+	var out []byte
+	for len(data) > 0 {
+		n := min(len(data), size)
+		out = append(out, gzipLevel(t, data[:n], gzip.DefaultCompression)...)
+		data = data[n:]
+	}
+	return out
+}
+
+func TestDecompressorMultiMemberMatchesSequential(t *testing.T) {
+	data := parallelInput()
+	inputs := map[string][]byte{
+		"bgzf":         bgzfData(t, data),
+		"concatenated": concatenated(t, data, 100000),
+		"large":        concatenated(t, data, maxMemberOutput+1000),
+		"single":       gzipLevel(t, data, gzip.DefaultCompression),
+		"zero padding": append(concatenated(t, data, 300000), make([]byte, 1000)...),
+	}
+	for name, input := range inputs {
+		want, err := decodeSequential(input)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, workers := range []int{1, 4} {
+			r := NewDecompressorMultiMember(bytes.NewReader(input), int64(len(input)), workers)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s, %d workers: %v", name, workers, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s, %d workers: output differs from the sequential decoder", name, workers)
+			}
+		}
+	}
+}
+
+func TestDecompressorMultiMemberErrors(t *testing.T) {
+	data := parallelInput()[:1<<20]
+	input := concatenated(t, data, 100000)
+	// the footer of the third member
+	third := len(concatenated(t, data[:300000], 100000)) - 8
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		kind   error
+	}{
+		{"crc", func(b []byte) []byte { b[third] ^= 1; return b }, ChecksumMismatch},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-100] }, io.ErrUnexpectedEOF},
+		{"empty", func(b []byte) []byte { return b[:0] }, EmptyInput},
+		{"garbage", func(b []byte) []byte { return append(b, "garbage"...) }, TrailingGarbage},
+	}
+	for _, test := range tests {
+		corrupt := test.modify(append([]byte(nil), input...))
+		r := NewDecompressorMultiMember(bytes.NewReader(corrupt), int64(len(corrupt)), 4)
+		_, err := io.Copy(io.Discard, r)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.kind)
+		}
+		if _, again := r.Read(make([]byte, 1)); again != err {
+			t.Errorf("%s: second Read returned %v", test.name, again)
+		}
+	}
+}
+
+func TestDecompressorMultiMemberWorkersExit(t *testing.T) {
+	input := concatenated(t, parallelInput()[:1<<20], 50000)
+	corrupt := input[:len(input)/2]
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		io.Copy(io.Discard, NewDecompressorMultiMember(bytes.NewReader(input), int64(len(input)), 4))
+		io.Copy(io.Discard, NewDecompressorMultiMember(bytes.NewReader(corrupt), int64(len(corrupt)), 4))
+	}
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running", runtime.NumGoroutine()-before)
+	}
+
+	r := NewDecompressorMultiMember(bytes.NewReader(input), int64(len(input)), 4)
+	r.Read(make([]byte, 100))
+	r.Close()
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running after Close", runtime.NumGoroutine()-before)
+	}
+	if _, err := io.Copy(io.Discard, r); err != io.ErrClosedPipe {
+		t.Errorf("Read after Close: %v", err)
+	}
+}
+
+func TestIsMultiMember(t *testing.T) {
+	data := parallelInput()[:1<<20]
+	tests := []struct {
+		name  string
+		input []byte
+		want  bool
+	}{
+		{"bgzf", bgzfData(t, data), true},
+		{"concatenated", concatenated(t, data, 300000), true},
+		{"single", gzipLevel(t, data, gzip.DefaultCompression), false},
+		{"garbage", []byte("not gzip data"), false},
+	}
+	for _, test := range tests {
+		if got := IsMultiMember(bytes.NewReader(test.input), int64(len(test.input))); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -1,52 +1,128 @@
-package main
+package gunzip
 
 import (
+	"context"
 	"io"
+	"sync/atomic"
 )
 
+// DecompressorMultithreaded decodes on a background goroutine, which exits
+// once the stream ends, the context is canceled or Close is called. A
+// goroutine blocked reading the underlying reader exits when that read
+// returns.
 type DecompressorMultithreaded struct {
-	c <-chan struct {
-		*Produce
-		error
-	}
-	buf      []uint8
-	begin    int
-	checksum Checksum
+	c         <-chan produced
+	parent    context.Context
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closed    atomic.Bool // set by Close, which may run during Read
+	bitreader *BitReader
+	producer  *Producer
+	buf       []uint8
+	begin     int
+	checksum  Checksum
 }
 
 func NewDecompressorMultithreaded(reader io.Reader) *DecompressorMultithreaded {
-	bitreader := NewBitReader(reader)
-	producer := NewProducer(bitreader)
-	checksum := NewCrc32()
+	return NewDecompressorMultithreadedContext(context.Background(), reader)
+}
 
-	c := make(chan struct {
-		*Produce
-		error
-	})
-	go produce(producer, c)
+// NewDecompressorMultithreadedContext returns a DecompressorMultithreaded
+// that stops decoding when ctx is canceled, after which Read returns the
+// error of ctx
+func NewDecompressorMultithreadedContext(ctx context.Context, reader io.Reader) *DecompressorMultithreaded {
+	bitreader := NewBitReader(reader)
+	d := &DecompressorMultithreaded{
+		parent:    ctx,
+		bitreader: bitreader,
+		producer:  NewProducer(bitreader),
+		buf:       make([]uint8, 0),
+		checksum:  NewCrc32(),
+	}
+	d.start()
+	return d
+}
 
-	return &DecompressorMultithreaded{c, make([]uint8, 0), 0, checksum}
+// start spawns the goroutine decoding the stream of d.producer
+func (d *DecompressorMultithreaded) start() {
+	c := make(chan produced)
+	d.c = c
+	d.ctx, d.cancel = context.WithCancel(d.parent)
+	go produce(d.ctx, d.producer, c)
 }
 
-func produce(producer *Producer, c chan<- struct {
+// produced is a result of the background goroutine. A footer comes with the
+// location of the producer right after it, as the goroutine moves on while
+// the reader verifies the footer.
+type produced struct {
 	*Produce
 	error
-}) {
+	at *Error
+}
+
+func produce(ctx context.Context, producer *Producer, c chan<- produced) {
+	defer close(c)
 	for {
 		produce, err := producer.Next()
-		done := produce == nil
-		c <- struct {
-			*Produce
-			error
-		}{produce, err}
+		done := produce == nil || err != nil
+		var at *Error
+		if !done && produce.Tag == ProduceFooter {
+			at = producer.annotate(&Error{}).(*Error)
+		}
+		select {
+		case c <- produced{produce, err, at}:
+		case <-ctx.Done():
+			return
+		}
 		if done {
 			break
 		}
 	}
 }
 
+// Close stops the background goroutine. It may be called while another
+// goroutine is in Read or WriteTo, which then return io.ErrClosedPipe. It
+// does not close the underlying reader.
+func (d *DecompressorMultithreaded) Close() error {
+	d.closed.Store(true)
+	d.cancel()
+	return nil
+}
+
+// Reset stops the background goroutine and, once it has exited, starts
+// decoding a new stream from reader under the same context, reusing the
+// decoder state. A closed decompressor can be reset too.
+func (d *DecompressorMultithreaded) Reset(reader io.Reader) {
+	d.cancel()
+	for range d.c {
+	}
+	d.bitreader.Reset(reader)
+	d.producer.Reset(d.bitreader)
+	d.checksum.Reset()
+	d.buf = d.buf[:0]
+	d.begin = 0
+	d.closed.Store(false)
+	d.start()
+}
+
 func (d *DecompressorMultithreaded) fillBuffer() (int, error) {
-	for pair := range d.c {
+	for {
+		if d.closed.Load() {
+			return 0, io.ErrClosedPipe
+		}
+		var pair produced
+		var ok bool
+		select {
+		case pair, ok = <-d.c:
+		case <-d.ctx.Done():
+			if d.closed.Load() {
+				return 0, io.ErrClosedPipe
+			}
+			return 0, d.ctx.Err()
+		}
+		if !ok {
+			return 0, io.EOF
+		}
 		produce := pair.Produce
 		err := pair.error
 
@@ -54,19 +130,17 @@ func (d *DecompressorMultithreaded) fillBuffer() (int, error) {
 			return 0, err
 		}
 		if produce == nil {
-			return 0, nil
+			return 0, io.EOF
 		}
 		if produce.Tag == ProduceHeader {
-			// nothing to do
+			// members in the legacy formats leave data without a footer
+			d.checksum.Reset()
 		} else if produce.Tag == ProduceFooter {
-			footer := produce.Foot
-			if d.checksum.Checksum() != footer.Crc32 {
-				return 0, NewError(ChecksumMismatch)
+			if err := produce.Foot.Verify(d.checksum); err != nil {
+				e := *pair.at
+				e.Kind = err.(*Error).Kind
+				return 0, &e
 			}
-			if d.checksum.Len()&0xFFFFFFFF != int(footer.Size) {
-				return 0, NewError(SizeMismatch)
-			}
-			d.checksum.ResetLen()
 		} else if produce.Tag == ProduceData {
 			xs := produce.Data
 			if len(xs) == 0 {
@@ -78,7 +152,6 @@ func (d *DecompressorMultithreaded) fillBuffer() (int, error) {
 			return len(xs), nil
 		}
 	}
-	panic("unreachable")
 }
 
 func (d *DecompressorMultithreaded) Read(buf []uint8) (int, error) {
@@ -104,3 +177,29 @@ func (d *DecompressorMultithreaded) Read(buf []uint8) (int, error) {
 
 	return nbytes, nil
 }
+
+// WriteTo implements io.WriterTo, writing the decoded data without copying it
+// to an intermediate buffer
+func (d *DecompressorMultithreaded) WriteTo(writer io.Writer) (int64, error) {
+	total := int64(0)
+	for {
+		if d.begin < len(d.buf) {
+			n, err := writer.Write(d.buf[d.begin:])
+			total += int64(n)
+			d.begin += n
+			if err != nil {
+				return total, err
+			}
+			if d.begin < len(d.buf) {
+				return total, io.ErrShortWrite
+			}
+		}
+		_, err := d.fillBuffer()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
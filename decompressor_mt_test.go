@@ -0,0 +1,120 @@
+package gunzip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestDecompressorMultithreaded(t *testing.T) {
+	for name, data := range testInputs() {
+		input := append(gzipData(t, data), gzipData(t, data)...)
+		r := NewDecompressorMultithreaded(bytes.NewReader(input))
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, append(bytes.Clone(data), data...)) {
+			t.Fatalf("%s: output mismatch", name)
+		}
+	}
+}
+
+func TestDecompressorMultithreadedChecksumError(t *testing.T) {
+	// the error names the member whose footer does not match, as the
+	// sequential decoder does, although the goroutine has moved past it
+	first := gzipData(t, []byte("first member"))
+	second := gzipData(t, []byte("second member"))
+	second[len(second)-8] ^= 1
+	input := append(append(first, second...), gzipData(t, []byte("third member"))...)
+
+	_, want := io.ReadAll(NewReader(bytes.NewReader(input)))
+	r := NewDecompressorMultithreaded(bytes.NewReader(input))
+	defer r.Close()
+	_, err := io.ReadAll(r)
+	var got, expected *Error
+	if !errors.As(err, &got) || !errors.As(want, &expected) {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+	if *got != *expected || got.Kind != ChecksumMismatch || got.Member != 2 {
+		t.Fatalf("got %+v, want %+v", got, expected)
+	}
+}
+
+// closingWriter closes a decompressor during its first write
+type closingWriter struct {
+	closer io.Closer
+	once   sync.Once
+}
+
+func (w *closingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { w.closer.Close() })
+	return len(p), nil
+}
+
+func TestDecompressorMultithreadedClose(t *testing.T) {
+	input := gzipLevel(t, parallelInput(), 6)
+	before := runtime.NumGoroutine()
+
+	// Close from the consumer while io.Copy is running
+	r := NewDecompressorMultithreaded(bytes.NewReader(input))
+	done := make(chan error)
+	go func() {
+		_, err := io.Copy(&closingWriter{closer: r}, r)
+		done <- err
+	}()
+	if err := <-done; err != io.ErrClosedPipe {
+		t.Errorf("io.Copy after Close: %v", err)
+	}
+
+	// Close from another goroutine, which races with Read
+	r = NewDecompressorMultithreaded(bytes.NewReader(input))
+	go func() {
+		_, err := io.Copy(io.Discard, r)
+		done <- err
+	}()
+	r.Close()
+	if err := <-done; err != nil && err != io.ErrClosedPipe {
+		t.Errorf("io.Copy during Close: %v", err)
+	}
+
+	// an abandoned reader
+	r = NewDecompressorMultithreaded(bytes.NewReader(input))
+	r.Read(make([]byte, 1000))
+	r.Close()
+
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running", runtime.NumGoroutine()-before)
+	}
+}
+
+func TestDecompressorMultithreadedContext(t *testing.T) {
+	input := gzipLevel(t, parallelInput(), 6)
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewDecompressorMultithreadedContext(ctx, bytes.NewReader(input))
+	if _, err := r.Read(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := io.Copy(io.Discard, r); err != context.Canceled {
+		t.Errorf("got %v after cancel, want %v", err, context.Canceled)
+	}
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running", runtime.NumGoroutine()-before)
+	}
+
+	// the goroutine exits by itself at the end of the stream
+	r = NewDecompressorMultithreaded(bytes.NewReader(input))
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running at EOF", runtime.NumGoroutine()-before)
+	}
+}
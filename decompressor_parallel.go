@@ -0,0 +1,370 @@
+package gunzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"sync/atomic"
+)
+
+// size of the input regions in which workers look for a block to start
+// decoding from
+const ParallelChunkSize = 1 << 20
+
+// upper bound on the size of a dynamic block header in bytes
+const maxDynamicHeader = 512
+
+// decoding of a chunk stops at the next block boundary once it has produced
+// this many bytes
+const maxChunkOutput = 16 << 20
+
+// DecompressorParallel decodes a gzip file with several goroutines, even
+// when it consists of a single member. The input is divided into chunks of
+// ParallelChunkSize bytes; for each chunk a worker locates the first dynamic
+// block header that decodes successfully and decodes from there, leaving
+// references into the unknown preceding window as markers. The chunks are
+// then joined in order: a chunk is used if it starts exactly where the
+// previous one ended, its markers being resolved from the now known window,
+// and is otherwise decoded again from the right offset.
+//
+// The workers exit once Read returns io.EOF or an error. A reader abandoned
+// before that must be closed with Close.
+type DecompressorParallel struct {
+	input   io.ReaderAt
+	size    int64
+	workers int
+	chunks  []*chunkJob
+	jobs    chan *chunkJob
+	next    int   // index of the next chunk to schedule
+	pos     int64 // bit offset of the next block to decode
+	window  []uint8
+	members int
+	done    bool  // the input ended or decoding failed
+	err     error // returned instead of io.EOF once done
+	stopped bool  // the workers were told to exit
+	closed  bool
+
+	buf      []uint8
+	begin    int
+	checksum Checksum
+}
+
+type chunkJob struct {
+	idx     int
+	from    int64 // first bit offset to try
+	to      int64 // end of the bit offsets to try
+	start   int64 // bit offset decoding started from, -1 if none
+	end     int64
+	symbols []uint16
+	footers []chunkFooter
+	eos     bool
+	garbage error
+	cancel  atomic.Bool
+	done    chan struct{}
+}
+
+// NewDecompressorParallel returns a DecompressorParallel reading size bytes
+// of gzip data from input with the given number of workers, or one per CPU if
+// workers < 1
+func NewDecompressorParallel(input io.ReaderAt, size int64, workers int) *DecompressorParallel {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	nchunks := int((size + ParallelChunkSize - 1) / ParallelChunkSize)
+	d := &DecompressorParallel{
+		input:    input,
+		size:     size,
+		workers:  workers,
+		chunks:   make([]*chunkJob, nchunks),
+		jobs:     make(chan *chunkJob, nchunks),
+		pos:      -1,
+		window:   make([]uint8, 0, MAX_DISTANCE),
+		buf:      make([]uint8, 0),
+		checksum: NewCrc32(),
+	}
+	for i := 0; i < workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+func (d *DecompressorParallel) work() {
+	for job := range d.jobs {
+		if !job.cancel.Load() {
+			d.decodeSpeculatively(job)
+		}
+		close(job.done)
+	}
+}
+
+// Close stops the workers. It does not close the input.
+func (d *DecompressorParallel) Close() error {
+	d.closed = true
+	d.stop()
+	return nil
+}
+
+// stop cancels the chunks in flight and lets the workers exit
+func (d *DecompressorParallel) stop() {
+	if d.stopped {
+		return
+	}
+	d.stopped = true
+	for _, job := range d.chunks {
+		if job != nil {
+			job.cancel.Store(true)
+		}
+	}
+	close(d.jobs)
+}
+
+// schedule hands chunks up to a few per worker ahead of chunk idx to the
+// workers, and cancels those left behind
+func (d *DecompressorParallel) schedule(idx int) {
+	for d.next < min(len(d.chunks), idx+2*d.workers) {
+		from := int64(d.next) * ParallelChunkSize * 8
+		job := &chunkJob{
+			idx:   d.next,
+			from:  from,
+			to:    min(from+ParallelChunkSize*8, d.size*8),
+			start: -1,
+			done:  make(chan struct{}),
+		}
+		if d.next == 0 {
+			// the first chunk starts right after the first header
+			job.from, job.to = d.pos, d.pos+1
+		}
+		d.chunks[d.next] = job
+		d.jobs <- job
+		d.next++
+	}
+	for i := 0; i < idx; i++ {
+		if job := d.chunks[i]; job != nil {
+			job.cancel.Store(true)
+			d.chunks[i] = nil
+		}
+	}
+}
+
+// decodeSpeculatively looks for the first offset in [job.from, job.to) from
+// which decoding succeeds up to the end of the chunk
+func (d *DecompressorParallel) decodeSpeculatively(job *chunkJob) {
+	stop := (int64(job.idx) + 1) * ParallelChunkSize * 8
+	var buf []uint8
+	var header *BitReader
+	if job.idx > 0 {
+		// the candidate offsets plus room for the longest dynamic block
+		// header, padded so that isBlockCandidate can always read ahead
+		first := job.from / 8
+		buf = make([]uint8, min(job.to/8+maxDynamicHeader, d.size)-first+16)
+		n, _ := d.input.ReadAt(buf[:len(buf)-16], first)
+		buf = buf[:n+16]
+		header = NewBitReader(nil)
+	}
+	for bit := job.from; bit < job.to; bit++ {
+		if job.cancel.Load() {
+			return
+		}
+		var decoder *ChunkDecoder
+		if job.idx == 0 {
+			decoder = NewChunkDecoder(d.input, d.size, bit, []uint8{})
+		} else {
+			offset := bit - job.from/8*8
+			if !isBlockCandidate(buf, offset) || !isDynamicBlock(header, buf, offset) {
+				continue
+			}
+			decoder = NewChunkDecoder(d.input, d.size, bit, nil)
+		}
+		decoder.cancel = &job.cancel
+		eos, err := decoder.Run(stop, maxChunkOutput)
+		if err != nil {
+			continue
+		}
+		job.start = bit
+		job.end = decoder.BitOffset()
+		job.symbols = decoder.Symbols()
+		job.footers = decoder.footers
+		job.eos = eos
+		job.garbage = decoder.garbage
+		return
+	}
+}
+
+// isBlockCandidate quickly checks whether the bits at offset bit of buf may
+// be the header of a non-final dynamic block: the counts must be in range and
+// the code length code must be complete
+func isBlockCandidate(buf []uint8, bit int64) bool {
+	if int(bit/8)+16 > len(buf) {
+		return false
+	}
+	bits := binary.LittleEndian.Uint64(buf[bit/8:]) >> (bit % 8)
+	if bits&0b111 != 0b100 {
+		return false
+	}
+	hlit := (bits >> 3) & 0x1F
+	hdist := (bits >> 8) & 0x1F
+	hclen := int((bits>>13)&0xF) + 4
+	if hlit > 29 || hdist > 29 {
+		return false
+	}
+	bit += 17
+	bits = binary.LittleEndian.Uint64(buf[bit/8:]) >> (bit % 8)
+	left := 0
+	count := 0
+	for i := 0; i < hclen; i++ {
+		length := (bits >> (3 * i)) & 0b111
+		if length > 0 {
+			left += 1 << (7 - length)
+			count++
+		}
+	}
+	return left == 1<<7 || (count == 1 && left == 1<<6)
+}
+
+// isDynamicBlock checks that a complete dynamic block header with an end of
+// block code starts at offset bit of buf, using reader as scratch
+func isDynamicBlock(reader *BitReader, buf []uint8, bit int64) bool {
+	reader.Reset(bytes.NewReader(buf[bit/8:]))
+	reader.Consume(int(bit % 8))
+	if _, err := reader.ReadBits(3); err != nil {
+		return false
+	}
+	llCodes, distCodes, err := ReadDynamicCodebooks(reader)
+	if err != nil {
+		return false
+	}
+	return llCodes.Book[END_OF_BLOCK].Length > 0 && llCodes.IsComplete() && distCodes.IsComplete()
+}
+
+func (d *DecompressorParallel) fillBuffer() (int, error) {
+	for {
+		n, err := d.decodeNext()
+		if err != nil && !d.done {
+			// decoding errors are final
+			d.done, d.err = true, err
+		}
+		if d.done {
+			d.stop()
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// decodeNext decodes from the current position up to the end of the chunk it
+// lies in
+func (d *DecompressorParallel) decodeNext() (int, error) {
+	if d.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if d.done {
+		if d.err != nil {
+			return 0, d.err
+		}
+		return 0, io.EOF
+	}
+	if d.pos < 0 {
+		if err := d.readFirstHeader(); err != nil {
+			return 0, err
+		}
+	}
+
+	idx := int(d.pos / (ParallelChunkSize * 8))
+	d.schedule(idx)
+	job := d.chunks[idx]
+	if job != nil {
+		<-job.done
+	}
+	var symbols []uint16
+	var footers []chunkFooter
+	var eos bool
+	var garbage error
+	if job != nil && job.start == d.pos {
+		symbols, footers, eos, garbage = job.symbols, job.footers, job.eos, job.garbage
+		d.pos = job.end
+		job.symbols = nil
+	} else {
+		// no usable speculative result: decode with the known window
+		stop := (int64(idx) + 1) * ParallelChunkSize * 8
+		decoder := NewChunkDecoder(d.input, d.size, d.pos, d.window)
+		var err error
+		eos, err = decoder.Run(stop, maxChunkOutput)
+		if err != nil {
+			return 0, err
+		}
+		symbols, footers, garbage = decoder.Symbols(), decoder.footers, decoder.garbage
+		d.pos = decoder.BitOffset()
+	}
+
+	data, err := ResolveMarkers(symbols, d.window)
+	if err != nil {
+		return 0, err
+	}
+	begin := 0
+	for _, f := range footers {
+		d.checksum.Update(data[begin:f.pos])
+		begin = f.pos
+		if err := f.footer.Verify(d.checksum); err != nil {
+			return 0, err
+		}
+	}
+	d.checksum.Update(data[begin:])
+	d.slideWindow(data)
+	d.done = eos
+	d.err = garbage
+	d.buf = data
+	d.begin = 0
+	return len(data), nil
+}
+
+func (d *DecompressorParallel) readFirstHeader() error {
+	reader := NewBitReader(io.NewSectionReader(d.input, 0, d.size))
+	dataLeft, err := reader.HasDataLeft()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if !dataLeft {
+		return NewError(EmptyInput)
+	}
+	if _, err := readGzipHeader(reader); err != nil {
+		return eofIsUnexpected(err)
+	}
+	d.pos = reader.BitOffset()
+	return nil
+}
+
+// slideWindow keeps the last MAX_DISTANCE bytes of output
+func (d *DecompressorParallel) slideWindow(data []uint8) {
+	if len(data) >= MAX_DISTANCE {
+		d.window = append(d.window[:0], data[len(data)-MAX_DISTANCE:]...)
+		return
+	}
+	drop := max(0, len(d.window)+len(data)-MAX_DISTANCE)
+	d.window = append(d.window[:copy(d.window, d.window[drop:])], data...)
+}
+
+func (d *DecompressorParallel) Read(buf []uint8) (int, error) {
+	nbytes := 0
+	idx := 0
+	for {
+		n := min(len(buf[idx:]), len(d.buf[d.begin:]))
+		copy(buf[idx:idx+n], d.buf[d.begin:d.begin+n])
+		idx += n
+		nbytes += n
+		d.begin += n
+		if idx == len(buf) {
+			break
+		}
+		filled, err := d.fillBuffer()
+		if err != nil {
+			return nbytes, err
+		}
+		if filled == 0 {
+			break
+		}
+	}
+
+	return nbytes, nil
+}
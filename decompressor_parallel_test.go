@@ -0,0 +1,140 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// parallelInput returns text that compresses to several ParallelChunkSize
+// chunks
+func parallelInput() []byte {
+	rng := rand.New(rand.NewSource(2))
+	data := make([]byte, 0, 4<<20)
+	for len(data) < cap(data)-64 {
+		// mostly literals, with enough repetition for matches
+		n := 1 + rng.Intn(40)
+		if rng.Intn(4) == 0 && len(data) > 1000 {
+			start := len(data) - 1 - rng.Intn(1000)
+			data = append(data, data[start:start+min(n, len(data)-start)]...)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			data = append(data, byte('a'+rng.Intn(26)))
+		}
+	}
+	return data
+}
+
+func gzipLevel(t *testing.T, data []byte, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, level)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// decodeSequential decodes input with Decompressor, the reference
+func decodeSequential(input []byte) ([]byte, error) {
+	return io.ReadAll(NewReader(bytes.NewReader(input)))
+}
+
+func TestDecompressorParallelMatchesSequential(t *testing.T) {
+	data := parallelInput()
+	half := len(data) / 2
+	inputs := map[string][]byte{
+		"default":  gzipLevel(t, data, gzip.DefaultCompression),
+		"stored":   gzipLevel(t, data, gzip.NoCompression),
+		"huffman":  gzipLevel(t, data, gzip.HuffmanOnly),
+		"members":  append(gzipLevel(t, data[:half], 6), gzipLevel(t, data[half:], 1)...),
+		"writer":   compress(t, data, DefaultCompression),
+		"small":    gzipLevel(t, data[:1000], gzip.DefaultCompression),
+		"trailing": append(gzipLevel(t, data, 6), make([]byte, 100)...),
+	}
+	for name, input := range inputs {
+		want, err := decodeSequential(input)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, workers := range []int{1, 3} {
+			r := NewDecompressorParallel(bytes.NewReader(input), int64(len(input)), workers)
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s, %d workers: %v", name, workers, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s, %d workers: output differs from the sequential decoder", name, workers)
+			}
+		}
+	}
+}
+
+func TestDecompressorParallelErrors(t *testing.T) {
+	input := gzipLevel(t, parallelInput(), gzip.DefaultCompression)
+	footer := len(input) - 8
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		kind   error
+	}{
+		{"crc", func(b []byte) []byte { b[footer] ^= 1; return b }, ChecksumMismatch},
+		{"truncated", func(b []byte) []byte { return b[:len(b)*2/3] }, io.ErrUnexpectedEOF},
+		{"empty", func(b []byte) []byte { return b[:0] }, EmptyInput},
+		{"garbage", func(b []byte) []byte { return append(b, "garbage"...) }, TrailingGarbage},
+	}
+	for _, test := range tests {
+		corrupt := test.modify(append([]byte(nil), input...))
+		r := NewDecompressorParallel(bytes.NewReader(corrupt), int64(len(corrupt)), 3)
+		_, err := io.Copy(io.Discard, r)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.kind)
+		}
+		// the error is final
+		if _, again := r.Read(make([]byte, 1)); again != err {
+			t.Errorf("%s: second Read returned %v", test.name, again)
+		}
+	}
+}
+
+// waitGoroutines waits for the number of goroutines to drop to n, and
+// reports whether it did
+func waitGoroutines(n int) bool {
+	for i := 0; i < 100; i++ {
+		if runtime.NumGoroutine() <= n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestDecompressorParallelWorkersExit(t *testing.T) {
+	input := gzipLevel(t, parallelInput(), gzip.DefaultCompression)
+	corrupt := append([]byte(nil), input[:len(input)/2]...)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		// read to the end, or to an error, without closing
+		io.Copy(io.Discard, NewDecompressorParallel(bytes.NewReader(input), int64(len(input)), 4))
+		io.Copy(io.Discard, NewDecompressorParallel(bytes.NewReader(corrupt), int64(len(corrupt)), 4))
+	}
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running", runtime.NumGoroutine()-before)
+	}
+
+	// abandoned readers are closed
+	r := NewDecompressorParallel(bytes.NewReader(input), int64(len(input)), 4)
+	r.Read(make([]byte, 100))
+	r.Close()
+	if !waitGoroutines(before) {
+		t.Errorf("%d goroutines left running after Close", runtime.NumGoroutine()-before)
+	}
+	if _, err := io.Copy(io.Discard, r); err != io.ErrClosedPipe {
+		t.Errorf("Read after Close: %v", err)
+	}
+}
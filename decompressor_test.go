@@ -0,0 +1,298 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// bitPacker writes DEFLATE bit fields, least significant bit first
+type bitPacker struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+func (b *bitPacker) write(value uint64, n uint) {
+	b.bits |= value << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.bits))
+		b.bits >>= 8
+		b.nbits -= 8
+	}
+}
+
+// writeCode writes a Huffman code, which is packed most significant bit first
+func (b *bitPacker) writeCode(code uint64, n uint) {
+	reversed := uint64(0)
+	for i := uint(0); i < n; i++ {
+		reversed |= (code >> i & 1) << (n - 1 - i)
+	}
+	b.write(reversed, n)
+}
+
+func (b *bitPacker) bytes() []byte {
+	if b.nbits > 0 {
+		b.write(0, 8-b.nbits)
+	}
+	return b.buf
+}
+
+// wrapGzip frames raw DEFLATE data of the given decoded content as a gzip
+// member
+func wrapGzip(deflate []byte, content []byte) []byte {
+	out := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+	out = append(out, deflate...)
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(content))
+	return binary.LittleEndian.AppendUint32(out, uint32(len(content)))
+}
+
+func TestLongFixedBlock(t *testing.T) {
+	// a single fixed Huffman block whose output spans several windows: a
+	// literal followed by matches of length 258 at distance 1
+	var b bitPacker
+	b.write(0b011, 3) // final, fixed
+	b.writeCode(0x30+'a', 8)
+	const matches = 2000
+	for i := 0; i < matches; i++ {
+		b.writeCode(0xc0+285-280, 8) // length 258
+		b.writeCode(0, 5)            // distance 1
+	}
+	b.writeCode(0, 7) // end of block
+	want := bytes.Repeat([]byte{'a'}, 1+258*matches)
+
+	got, err := io.ReadAll(NewReader(bytes.NewReader(wrapGzip(b.bytes(), want))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("decoded %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestStoredBlockAtEndOfInput(t *testing.T) {
+	// the stored block is read from the bit reader's buffer, after the
+	// underlying reader has reached its end
+	want := []byte("stored data at the end of the input")
+	var buf bytes.Buffer
+	w, _ := gzip.NewWriterLevel(&buf, gzip.NoCompression)
+	w.Write(want)
+	w.Close()
+
+	got, err := io.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// gzipData compresses data into a gzip member with compress/gzip
+func gzipData(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestTrailingData(t *testing.T) {
+	want := []byte("data followed by something that is not a member")
+	member := gzipData(t, want)
+	tests := []struct {
+		name     string
+		trailing []byte
+		garbage  bool
+	}{
+		{"zero padding", make([]byte, 1000), false},
+		{"garbage", []byte("garbage"), true},
+		{"zeros then garbage", []byte{0, 0, 0, 'x'}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := append(append([]byte(nil), member...), test.trailing...)
+			got, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+			if test.garbage != errors.Is(err, TrailingGarbage) || (!test.garbage && err != nil) {
+				t.Errorf("got error %v, want garbage %v", err, test.garbage)
+			}
+		})
+	}
+}
+
+func TestTruncatedSecondMember(t *testing.T) {
+	// a gzip magic after a member starts another one, even if it is cut short
+	input := append(gzipData(t, []byte("first")), ID1, ID2)
+	_, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got error %v, want unexpected EOF", err)
+	}
+}
+
+func TestResetMatchesNewReader(t *testing.T) {
+	// a reset decoder carries nothing over from the previous stream, so it
+	// decodes and fails exactly like a new one
+	data := testInputs()["text"]
+	member := gzipData(t, data)
+	corrupt := bytes.Clone(member)
+	corrupt[len(corrupt)/2] ^= 0xff
+	inputs := map[string][]byte{
+		"valid":          member,
+		"members":        append(bytes.Clone(member), member...),
+		"corrupt":        corrupt,
+		"truncated":      member[:len(member)/2],
+		"no blocks":      member[:10],
+		"second header":  append(bytes.Clone(member), ID1, ID2, DEFLATE),
+		"trailing":       append(bytes.Clone(member), 'x'),
+		"stored":         compress(t, data, NoCompression),
+		"stored cut":     compress(t, data, NoCompression)[:1000],
+		"lzw then short": lzwEncode(data, 16, true)[:5],
+	}
+	d := NewReader(nil)
+	for _, previous := range inputs {
+		for name, input := range inputs {
+			want, wantErr := io.ReadAll(NewReader(bytes.NewReader(input)))
+			d.Reset(bytes.NewReader(previous))
+			io.ReadAll(d)
+			d.Reset(bytes.NewReader(input))
+			got, err := io.ReadAll(d)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s: output differs after Reset", name)
+			}
+			var e, wantE *Error
+			if errors.As(err, &e) != errors.As(wantErr, &wantE) || (e != nil && *e != *wantE) || (e == nil && err != wantErr) {
+				t.Fatalf("%s: got error %+v after Reset, want %+v", name, err, wantErr)
+			}
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	member := gzipData(t, bytes.Repeat([]byte("limits\n"), 1000))
+	members := bytes.Repeat(member, 3)
+	zeros := gzipData(t, make([]byte, 8<<20))
+	small := gzipData(t, make([]byte, 64<<10))
+	tests := []struct {
+		name   string
+		input  []byte
+		limits Limits
+		fail   bool
+	}{
+		{"none", members, Limits{}, false},
+		{"output", members, Limits{MaxOutput: 20000}, true},
+		{"output at limit", members, Limits{MaxOutput: 21000}, false},
+		{"member output", members, Limits{MaxMemberOutput: 6999}, true},
+		{"member output at limit", members, Limits{MaxMemberOutput: 7000}, false},
+		{"members", members, Limits{MaxMembers: 2}, true},
+		{"members at limit", members, Limits{MaxMembers: 3}, false},
+		{"ratio", zeros, Limits{MaxRatio: 100}, true},
+		{"ratio below limit", zeros, Limits{MaxRatio: 2000}, false},
+		// the first RatioMinOutput bytes are let through
+		{"ratio of small output", small, Limits{MaxRatio: 10}, false},
+	}
+	for _, test := range tests {
+		d := NewReader(bytes.NewReader(test.input))
+		d.SetLimits(test.limits)
+		got, err := io.ReadAll(d)
+		if test.fail != errors.Is(err, LimitExceeded) {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+		if !test.fail && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if test.limits.MaxOutput > 0 && int64(len(got)) > test.limits.MaxOutput {
+			t.Errorf("%s: %d bytes output", test.name, len(got))
+		}
+	}
+}
+
+// limitWriter accepts limit bytes, then fails with errWrite, or with short
+// set, accepts part of the write without an error
+type limitWriter struct {
+	limit int
+	short bool
+	bytes.Buffer
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	n := min(len(p), w.limit-w.Len())
+	w.Buffer.Write(p[:n])
+	if n < len(p) && !w.short {
+		return n, errWrite
+	}
+	return n, nil
+}
+
+func TestWriteTo(t *testing.T) {
+	readers := map[string]func(io.Reader) io.ReadCloser{
+		"sequential":    func(r io.Reader) io.ReadCloser { return io.NopCloser(NewReader(r)) },
+		"multithreaded": func(r io.Reader) io.ReadCloser { return NewDecompressorMultithreaded(r) },
+	}
+	data := testInputs()["text"]
+	member := gzipData(t, data)
+	badCrc := bytes.Clone(member)
+	badCrc[len(badCrc)-8] ^= 1
+	inputs := map[string][]byte{
+		"multi-member": append(append(bytes.Clone(member), gzipData(t, nil)...), member...),
+		"bad crc":      append(bytes.Clone(member), badCrc...),
+		"truncated":    append(bytes.Clone(member), member[:len(member)/2]...),
+	}
+	for name, data := range testInputs() {
+		inputs[name] = gzipData(t, data)
+	}
+
+	for readerName, newReader := range readers {
+		for name, input := range inputs {
+			r := newReader(bytes.NewReader(input))
+			want, wantErr := io.ReadAll(r)
+			r.Close()
+			var got bytes.Buffer
+			r = newReader(bytes.NewReader(input))
+			n, err := r.(io.WriterTo).WriteTo(&got)
+			r.Close()
+			if !bytes.Equal(got.Bytes(), want) || n != int64(got.Len()) {
+				t.Errorf("%s %s: wrote %d bytes, read %d", readerName, name, n, len(want))
+			}
+			if !errors.Is(err, wantErr) {
+				t.Errorf("%s %s: got %v, want %v", readerName, name, err, wantErr)
+			}
+		}
+
+		// after a partial Read, WriteTo writes the rest
+		r := newReader(bytes.NewReader(member))
+		head := make([]byte, 1000)
+		io.ReadFull(r, head)
+		var rest bytes.Buffer
+		if _, err := io.Copy(&rest, r); err != nil || !bytes.Equal(append(head, rest.Bytes()...), data) {
+			t.Errorf("%s: WriteTo after Read: %v", readerName, err)
+		}
+		r.Close()
+
+		// errors of the writer are returned
+		for _, w := range []*limitWriter{{limit: 1000}, {limit: 1000, short: true}} {
+			r = newReader(bytes.NewReader(member))
+			n, err := r.(io.WriterTo).WriteTo(w)
+			r.Close()
+			want := errWrite
+			if w.short {
+				want = io.ErrShortWrite
+			}
+			if err != want || n != 1000 || !bytes.Equal(w.Bytes(), data[:1000]) {
+				t.Errorf("%s: got %d bytes and %v, want %v", readerName, n, err, want)
+			}
+		}
+	}
+}
@@ -1,12 +1,21 @@
-package main
+package gunzip
 
 import (
 	"fmt"
+	"strings"
 )
 
-// Error is a custom error type for the package
+// Error is a custom error type for the package. Errors returned while
+// decoding carry the position at which they were detected; fields that are
+// unknown are left zero.
 type Error struct {
-	Kind ErrorKind
+	Kind      ErrorKind
+	Member    int       // 1-based index of the member being decoded
+	BitOffset int64     // compressed bit offset at which the error was detected
+	Offset    int64     // uncompressed offset of the output produced so far
+	Block     int       // 1-based index of the block within the member
+	BlockType BlockType // type of that block
+	Err       error     // underlying error, such as an I/O error
 }
 
 // ErrorKind is an enum for the kinds of errors
@@ -25,14 +34,127 @@ const (
 	ReadDynamicCodebook
 	ChecksumMismatch
 	SizeMismatch
+	InvalidCompressionLevel
+	InvalidZlibHeader
+	DictionaryMismatch
+	InvalidZipArchive
+	UnsupportedZipMethod
+	InvalidLzwData
+	InvalidPackData
+	HeaderCrcMismatch
+	LimitExceeded
+	TrailingGarbage
+	MissingHistory
 )
 
+var errorKindNames = []string{
+	StdIoError:                 "I/O error",
+	EmptyInput:                 "empty input",
+	InvalidGzHeader:            "invalid gzip header",
+	InvalidBlockType:           "invalid block type",
+	BlockType0LenMismatch:      "stored block length does not match its complement",
+	InvalidCodeLengths:         "invalid Huffman code lengths",
+	HuffmanDecoderCodeNotFound: "invalid Huffman code",
+	DistanceTooMuch:            "distance too far back",
+	EndOfBlockNotFound:         "end of block not found",
+	ReadDynamicCodebook:        "invalid dynamic block header",
+	ChecksumMismatch:           "checksum mismatch",
+	SizeMismatch:               "length mismatch",
+	InvalidCompressionLevel:    "invalid compression level",
+	InvalidZlibHeader:          "invalid zlib header",
+	DictionaryMismatch:         "missing or wrong preset dictionary",
+	InvalidZipArchive:          "invalid ZIP archive",
+	UnsupportedZipMethod:       "unsupported ZIP compression method or encryption",
+	InvalidLzwData:             "invalid compress (.Z) data",
+	InvalidPackData:            "invalid pack (.z) data",
+	HeaderCrcMismatch:          "header CRC16 mismatch",
+	LimitExceeded:              "output limit exceeded",
+	TrailingGarbage:            "trailing garbage after the last member",
+	MissingHistory:             "reference to data lost in a damaged range",
+}
+
+func (k ErrorKind) String() string {
+	if k < 0 || int(k) >= len(errorKindNames) {
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+	return errorKindNames[k]
+}
+
+// Error lets a kind be used as the target of errors.Is
+func (k ErrorKind) Error() string {
+	return k.String()
+}
+
+// BlockType is the type of a DEFLATE block, from the BTYPE field of its
+// header
+type BlockType int
+
+const (
+	BlockStored BlockType = iota
+	BlockFixed
+	BlockDynamic
+	BlockReserved
+)
+
+func (t BlockType) String() string {
+	switch t {
+	case BlockStored:
+		return "stored"
+	case BlockFixed:
+		return "fixed"
+	case BlockDynamic:
+		return "dynamic"
+	}
+	return "reserved"
+}
+
 // Error implements the error interface for Error type
 func (e *Error) Error() string {
-	return fmt.Sprintf("%v", e.Kind)
+	var b strings.Builder
+	if e.Kind == StdIoError && e.Err != nil {
+		b.WriteString(e.Err.Error())
+	} else {
+		b.WriteString(e.Kind.String())
+		if e.Err != nil {
+			fmt.Fprintf(&b, ": %v", e.Err)
+		}
+	}
+	if e.Member == 0 && e.BitOffset == 0 && e.Offset == 0 {
+		return b.String()
+	}
+	b.WriteString(" (")
+	if e.Member > 0 {
+		fmt.Fprintf(&b, "member %d, ", e.Member)
+	}
+	if e.Block > 0 {
+		fmt.Fprintf(&b, "block %d %s, ", e.Block, e.BlockType)
+	}
+	fmt.Fprintf(&b, "bit offset %d, output offset %d)", e.BitOffset, e.Offset)
+	return b.String()
+}
+
+// Unwrap returns the underlying error, if any
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an ErrorKind or an *Error of the same kind
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorKind:
+		return e.Kind == t
+	case *Error:
+		return e.Kind == t.Kind
+	}
+	return false
 }
 
 // NewError creates a new Error with the given kind and message
 func NewError(kind ErrorKind) *Error {
 	return &Error{Kind: kind}
 }
+
+// NewIoError wraps an error of the underlying reader or writer
+func NewIoError(err error) *Error {
+	return &Error{Kind: StdIoError, Err: err}
+}
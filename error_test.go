@@ -0,0 +1,101 @@
+package gunzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestErrorIs(t *testing.T) {
+	cause := errors.New("cause")
+	err := &Error{Kind: ChecksumMismatch, Member: 2, Err: cause}
+	if !errors.Is(err, ChecksumMismatch) || errors.Is(err, SizeMismatch) {
+		t.Error("errors.Is does not match the kind")
+	}
+	if !errors.Is(err, NewError(ChecksumMismatch)) || errors.Is(err, NewError(SizeMismatch)) {
+		t.Error("errors.Is does not match an *Error by kind")
+	}
+	if !errors.Is(err, cause) || errors.Unwrap(err) != cause {
+		t.Error("the underlying error is not unwrapped")
+	}
+	if NewError(EmptyInput).Unwrap() != nil {
+		t.Error("Unwrap without an underlying error")
+	}
+	if errors.Is(err, io.EOF) {
+		t.Error("errors.Is matches an unrelated error")
+	}
+	var e *Error
+	if !errors.As(NewIoError(io.ErrClosedPipe), &e) || e.Kind != StdIoError || !errors.Is(e, io.ErrClosedPipe) {
+		t.Errorf("I/O error %v", e)
+	}
+}
+
+func TestErrorString(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{NewError(EmptyInput), "empty input"},
+		{NewIoError(io.ErrClosedPipe), io.ErrClosedPipe.Error()},
+		{&Error{Kind: LimitExceeded, Err: errors.New("more than 2 members")}, "output limit exceeded: more than 2 members"},
+		{&Error{Kind: DistanceTooMuch, Member: 2, BitOffset: 100, Offset: 9, Block: 2, BlockType: BlockFixed},
+			"distance too far back (member 2, block 2 fixed, bit offset 100, output offset 9)"},
+		{&Error{Kind: ChecksumMismatch, Member: 1, BitOffset: 80}, "checksum mismatch (member 1, bit offset 80, output offset 0)"},
+		{ErrorKind(-1), "ErrorKind(-1)"},
+		{ErrorKind(100), "ErrorKind(100)"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+	for kind := StdIoError; kind <= MissingHistory; kind++ {
+		if kind.String() == "" || kind.String() == (ErrorKind(-1)).String() {
+			t.Errorf("kind %d has no name", kind)
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	// the second member holds a stored block and a fixed block whose match
+	// reaches back past the start of the output
+	var b bitPacker
+	b.write(0b000, 3) // stored
+	b.write(0, 5)
+	b.write(3, 16)
+	b.write(0xfffc, 16)
+	for _, c := range []byte("abc") {
+		b.write(uint64(c), 8)
+	}
+	b.write(0b011, 3) // final, fixed
+	b.writeCode(0x30+'x', 8)
+	b.writeCode(257-256, 7) // length 3
+	b.writeCode(13, 5)      // distances 97 to 128
+	b.write(3, 5)
+	b.writeCode(0, 7)
+	first := gzipData(t, []byte("first"))
+	input := append(bytes.Clone(first), wrapGzip(b.bytes(), []byte("abcx"))...)
+
+	got, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != DistanceTooMuch {
+		t.Fatalf("got %v", err)
+	}
+	// the error is detected after the extra bits of the distance, and the
+	// pending literal has not been output
+	want := Error{
+		Kind:      DistanceTooMuch,
+		Member:    2,
+		BitOffset: int64(len(first)+10+8)*8 + 3 + 8 + 7 + 5 + 5,
+		Offset:    int64(len("first") + len("abc")),
+		Block:     2,
+		BlockType: BlockFixed,
+	}
+	if *e != want {
+		t.Errorf("got %+v, want %+v", *e, want)
+	}
+	if int64(len(got)) != e.Offset {
+		t.Errorf("%d bytes output, error at output offset %d", len(got), e.Offset)
+	}
+}
@@ -0,0 +1,91 @@
+package gunzip
+
+import (
+	"encoding/binary"
+)
+
+// Subfield is an entry of the extra field of a gzip header, identified by
+// the two bytes SI1 and SI2
+type Subfield struct {
+	SI1, SI2 byte
+	Data     []byte
+}
+
+// Subfields splits the extra field into its subfields. It fails if the
+// lengths of the subfields do not add up to that of the extra field.
+func (h *Header) Subfields() ([]Subfield, error) {
+	var subfields []Subfield
+	extra := h.ExtraField
+	for len(extra) > 0 {
+		if len(extra) < 4 {
+			return nil, NewError(InvalidGzHeader)
+		}
+		n := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if 4+n > len(extra) {
+			return nil, NewError(InvalidGzHeader)
+		}
+		subfields = append(subfields, Subfield{extra[0], extra[1], extra[4 : 4+n]})
+		extra = extra[4+n:]
+	}
+	return subfields, nil
+}
+
+// Subfield returns the data of the first subfield with the given ID, and
+// false if there is none or the extra field is malformed
+func (h *Header) Subfield(si1, si2 byte) ([]byte, bool) {
+	subfields, err := h.Subfields()
+	if err != nil {
+		return nil, false
+	}
+	for _, s := range subfields {
+		if s.SI1 == si1 && s.SI2 == si2 {
+			return s.Data, true
+		}
+	}
+	return nil, false
+}
+
+// RandomAccess is the RA subfield written by dictzip. The data of the member
+// is compressed in chunks of ChunkLength bytes, each ending with a full
+// flush, so that decoding can start at any chunk with an empty history.
+type RandomAccess struct {
+	Version     int
+	ChunkLength int
+	ChunkSizes  []int // compressed size of each chunk
+}
+
+// ReadRandomAccess decodes the RA subfield of a header, and returns false if
+// the header has none or it is malformed
+func ReadRandomAccess(h *Header) (*RandomAccess, bool) {
+	data, ok := h.Subfield('R', 'A')
+	if !ok || len(data) < 6 {
+		return nil, false
+	}
+	ra := &RandomAccess{
+		Version:     int(binary.LittleEndian.Uint16(data[0:2])),
+		ChunkLength: int(binary.LittleEndian.Uint16(data[2:4])),
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	if ra.Version != 1 || ra.ChunkLength == 0 || len(data) != 6+2*count {
+		return nil, false
+	}
+	for i := 0; i < count; i++ {
+		ra.ChunkSizes = append(ra.ChunkSizes, int(binary.LittleEndian.Uint16(data[6+2*i:])))
+	}
+	return ra, true
+}
+
+// Locate returns the chunk holding uncompressed offset, and the offset of
+// that chunk relative to the start of the compressed data that follows the
+// header. It returns -1 if offset is past the last chunk.
+func (ra *RandomAccess) Locate(offset int64) (chunk int, compressed int64) {
+	chunk64 := offset / int64(ra.ChunkLength)
+	if offset < 0 || chunk64 >= int64(len(ra.ChunkSizes)) {
+		return -1, 0
+	}
+	chunk = int(chunk64)
+	for _, size := range ra.ChunkSizes[:chunk] {
+		compressed += int64(size)
+	}
+	return chunk, compressed
+}
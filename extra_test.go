@@ -0,0 +1,133 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// dictzipData compresses data as dictzip does: in chunks of chunkLength
+// bytes that each end with a flush and refer to no earlier chunk, listed in
+// an RA subfield that follows an unrelated subfield
+func dictzipData(t *testing.T, data []byte, chunkLength int) []byte {
+	t.Helper()
+	var deflate bytes.Buffer
+	var sizes []int
+	for start := 0; start < len(data); start += chunkLength {
+		before := deflate.Len()
+		w, _ := flate.NewWriter(&deflate, flate.DefaultCompression)
+		w.Write(data[start:min(start+chunkLength, len(data))])
+		if start+chunkLength < len(data) {
+			w.Flush()
+		} else {
+			w.Close()
+		}
+		sizes = append(sizes, deflate.Len()-before)
+	}
+	ra := binary.LittleEndian.AppendUint16(nil, 1)
+	ra = binary.LittleEndian.AppendUint16(ra, uint16(chunkLength))
+	ra = binary.LittleEndian.AppendUint16(ra, uint16(len(sizes)))
+	for _, size := range sizes {
+		ra = binary.LittleEndian.AppendUint16(ra, uint16(size))
+	}
+	extra := []byte{'X', 'Y', 1, 0, 42, 'R', 'A'}
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(ra)))
+	extra = append(extra, ra...)
+
+	out := []byte{ID1, ID2, DEFLATE, FEXTRA, 0, 0, 0, 0, 0, 3}
+	out = binary.LittleEndian.AppendUint16(out, uint16(len(extra)))
+	out = append(append(out, extra...), deflate.Bytes()...)
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(data))
+	return binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+}
+
+func TestSubfields(t *testing.T) {
+	input := dictzipData(t, []byte("data"), 1000)
+	h, err := ReadHeader(NewBitReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subfields, err := h.Subfields()
+	if err != nil || len(subfields) != 2 || subfields[0].SI1 != 'X' || !bytes.Equal(subfields[0].Data, []byte{42}) || subfields[1].SI2 != 'A' {
+		t.Fatalf("subfields %v, %v", subfields, err)
+	}
+	if data, ok := h.Subfield('X', 'Y'); !ok || !bytes.Equal(data, []byte{42}) {
+		t.Errorf("XY subfield %v, %v", data, ok)
+	}
+	if _, ok := h.Subfield('Z', 'Z'); ok {
+		t.Error("found a missing subfield")
+	}
+
+	for _, extra := range [][]byte{
+		{'X', 'Y', 1},       // truncated subfield header
+		{'X', 'Y', 2, 0, 1}, // data shorter than its length
+	} {
+		malformed := Header{ExtraField: extra}
+		if _, err := malformed.Subfields(); err == nil {
+			t.Errorf("%v: no error", extra)
+		}
+		if _, ok := malformed.Subfield('X', 'Y'); ok {
+			t.Errorf("%v: found a subfield", extra)
+		}
+	}
+}
+
+func TestRandomAccess(t *testing.T) {
+	data := testInputs()["text"][:100000]
+	const chunkLength = 8000
+	input := dictzipData(t, data, chunkLength)
+
+	// the member is also an ordinary gzip member
+	got, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("decoding the member: %v", err)
+	}
+
+	h, err := ReadHeader(NewBitReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, ok := ReadRandomAccess(h)
+	if !ok || ra.Version != 1 || ra.ChunkLength != chunkLength || len(ra.ChunkSizes) != (len(data)+chunkLength-1)/chunkLength {
+		t.Fatalf("RA subfield %+v, %v", ra, ok)
+	}
+	for _, offset := range []int64{0, chunkLength - 1, chunkLength, 5*chunkLength + 17, int64(len(data)) - 1} {
+		chunk, compressed := ra.Locate(offset)
+		if chunk != int(offset/chunkLength) {
+			t.Fatalf("offset %d in chunk %d", offset, chunk)
+		}
+		// a chunk ends with a flush rather than a final block: read only
+		// its length from the rest of the member
+		start := int64(chunk * chunkLength)
+		r := NewRawReader(bytes.NewReader(input[int64(h.Size)+compressed:]))
+		got := make([]byte, min(chunkLength, int64(len(data))-start))
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("offset %d: %v", offset, err)
+		}
+		if !bytes.Equal(got, data[start:start+int64(len(got))]) {
+			t.Fatalf("offset %d: chunk %d differs", offset, chunk)
+		}
+	}
+	for _, offset := range []int64{-1, int64(len(ra.ChunkSizes) * chunkLength)} {
+		if chunk, _ := ra.Locate(offset); chunk != -1 {
+			t.Errorf("offset %d in chunk %d", offset, chunk)
+		}
+	}
+
+	for _, ra := range [][]byte{
+		{2, 0, 0, 1, 0, 0},       // version
+		{1, 0, 0, 0, 0, 0},       // chunk length
+		{1, 0, 0, 1, 2, 0, 1, 0}, // chunk count
+	} {
+		extra := append([]byte{'R', 'A', uint8(len(ra)), 0}, ra...)
+		if _, ok := ReadRandomAccess(&Header{ExtraField: extra}); ok {
+			t.Errorf("%v: accepted", ra)
+		}
+	}
+	if _, ok := ReadRandomAccess(&Header{}); ok {
+		t.Error("RA subfield found in an empty header")
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package gunzip
 
 import (
 	"encoding/binary"
@@ -15,3 +15,20 @@ func ReadFooter(reader io.Reader) (*Footer, error) {
 	err := binary.Read(reader, binary.LittleEndian, &f)
 	return &f, err
 }
+
+func WriteFooter(writer io.Writer, f *Footer) error {
+	return binary.Write(writer, binary.LittleEndian, f)
+}
+
+// Verify checks the CRC32 and ISIZE accumulated in checksum against the
+// footer and resets the length count for the next member
+func (f *Footer) Verify(checksum Checksum) error {
+	if checksum.Checksum() != f.Crc32 {
+		return NewError(ChecksumMismatch)
+	}
+	if checksum.Len()&0xFFFFFFFF != int(f.Size) {
+		return NewError(SizeMismatch)
+	}
+	checksum.ResetLen()
+	return nil
+}
@@ -1,9 +1,12 @@
-package main
+package gunzip
 
 import (
 	"bytes"
 	"encoding/binary"
+	"hash/crc32"
 	"io"
+	"strings"
+	"time"
 )
 
 const (
@@ -15,20 +18,38 @@ const (
 	FEXTRA   = 4
 	FNAME    = 8
 	FCOMMENT = 16
+
+	LZW_ID2  = 0x9d // compress (.Z)
+	PACK_ID2 = 0x1e // pack (.z)
 )
 
 type Header struct {
 	Header     [10]byte
 	ExtraField []byte
-	Name       []byte
-	Comment    []byte
+	RawName    []byte // ISO-8859-1 as stored, without the terminating zero
+	RawComment []byte // ISO-8859-1 as stored, without the terminating zero
 	Crc16      uint16
 	Size       int // header size
 }
 
+// ReadHeader reads a gzip member header. If FHCRC is set, the CRC16 is checked
+// against the header bytes.
 func ReadHeader(r BitRead) (*Header, error) {
+	return readHeader(r, true)
+}
+
+func readHeader(r BitRead, checkCrc bool) (*Header, error) {
 	var h Header
-	err := r.ReadExact(h.Header[:])
+	err := r.ReadExact(h.Header[:2])
+	if err != nil {
+		return nil, err
+	}
+	if h.IsLegacy() {
+		// the rest of the header is read by the legacy decoder
+		h.Size = 2
+		return &h, nil
+	}
+	err = r.ReadExact(h.Header[2:])
 	if err != nil {
 		return nil, err
 	}
@@ -51,18 +72,18 @@ func ReadHeader(r BitRead) (*Header, error) {
 		h.Size += int(n) // size of extra field
 	}
 	if h.getFlg()&FNAME != 0 {
-		h.Name, err = readUntil(r, 0)
+		h.RawName, err = readUntil(r, 0)
 		if err != nil {
 			return nil, err
 		}
-		h.Size += len(h.Name) // size of name
+		h.Size += len(h.RawName) + 1 // size of name and zero
 	}
 	if h.getFlg()&FCOMMENT != 0 {
-		h.Comment, err = readUntil(r, 0)
+		h.RawComment, err = readUntil(r, 0)
 		if err != nil {
 			return nil, err
 		}
-		h.Size += len(h.Comment) // size of comment
+		h.Size += len(h.RawComment) + 1 // size of comment and zero
 	}
 	if h.getFlg()&FHCRC != 0 {
 		err := binary.Read(r, binary.LittleEndian, &h.Crc16)
@@ -70,15 +91,145 @@ func ReadHeader(r BitRead) (*Header, error) {
 			return nil, err
 		}
 		h.Size += 2 // size of crc16
+		if checkCrc && h.Crc16 != h.headerCrc16() {
+			return nil, NewError(HeaderCrcMismatch)
+		}
 	}
 	return &h, nil
 }
 
+// IsLegacy reports whether the header starts a compress (.Z) or pack (.z)
+// stream rather than a gzip member. Only the magic bytes of such headers are
+// read.
+func (h *Header) IsLegacy() bool {
+	return h.Header[0] == ID1 && (h.Header[1] == LZW_ID2 || h.Header[1] == PACK_ID2)
+}
+
+// ModTime returns the modification time of the original file, or the zero
+// time if none is recorded
+func (h *Header) ModTime() time.Time {
+	mtime := binary.LittleEndian.Uint32(h.Header[4:8])
+	if mtime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(mtime), 0)
+}
+
+// ExtraFlags returns the XFL byte: 2 for maximum compression, 4 for fastest
+func (h *Header) ExtraFlags() uint8 {
+	return h.Header[8]
+}
+
+// OS returns the OS byte, the type of file system the member was created on
+func (h *Header) OS() uint8 {
+	return h.Header[9]
+}
+
+// IsText reports whether FTEXT is set, a hint that the data is text
+func (h *Header) IsText() bool {
+	return h.getFlg()&FTEXT != 0
+}
+
+// Name returns the original file name decoded as ISO-8859-1, or "" if none
+// is recorded
+func (h *Header) Name() string {
+	return fromLatin1(h.RawName)
+}
+
+// Comment returns the comment decoded as ISO-8859-1, or "" if none is
+// recorded
+func (h *Header) Comment() string {
+	return fromLatin1(h.RawComment)
+}
+
+// fromLatin1 decodes ISO-8859-1
+func fromLatin1(b []byte) string {
+	var s strings.Builder
+	for _, c := range b {
+		s.WriteRune(rune(c))
+	}
+	return s.String()
+}
+
+// readGzipHeader is like ReadHeader but rejects the legacy formats, for
+// decoders that only handle DEFLATE
+func readGzipHeader(r BitRead) (*Header, error) {
+	h, err := ReadHeader(r)
+	if err == nil && h.IsLegacy() {
+		return nil, NewError(InvalidGzHeader)
+	}
+	return h, err
+}
+
+// WriteHeader serializes h. RawName and RawComment are written followed by a
+// zero byte, and must not contain one.
+func WriteHeader(writer io.Writer, h *Header) error {
+	err := writeHeaderFields(writer, h)
+	if err != nil {
+		return err
+	}
+	if h.getFlg()&FHCRC != 0 {
+		err := binary.Write(writer, binary.LittleEndian, h.Crc16)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// headerCrc16 returns the low 16 bits of the CRC32 of the header bytes that
+// precede the CRC16
+func (h *Header) headerCrc16() uint16 {
+	crc := crc32.NewIEEE()
+	writeHeaderFields(crc, h)
+	return uint16(crc.Sum32())
+}
+
+// writeHeaderFields serializes h up to, but not including, the CRC16
+func writeHeaderFields(writer io.Writer, h *Header) error {
+	_, err := writer.Write(h.Header[:])
+	if err != nil {
+		return err
+	}
+	if h.getFlg()&FEXTRA != 0 {
+		err := binary.Write(writer, binary.LittleEndian, uint16(len(h.ExtraField)))
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(h.ExtraField)
+		if err != nil {
+			return err
+		}
+	}
+	if h.getFlg()&FNAME != 0 {
+		_, err := writer.Write(h.RawName)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write([]byte{0})
+		if err != nil {
+			return err
+		}
+	}
+	if h.getFlg()&FCOMMENT != 0 {
+		_, err := writer.Write(h.RawComment)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write([]byte{0})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // getFlg returns the FLG byte of the header
 func (h *Header) getFlg() byte {
 	return h.Header[3]
 }
 
+// readUntil reads up to and including delim, and returns the bytes before it
 func readUntil(r io.Reader, delim byte) ([]byte, error) {
 	var buf bytes.Buffer
 	var b [1]byte
@@ -87,10 +238,10 @@ func readUntil(r io.Reader, delim byte) ([]byte, error) {
 		if err != nil {
 			return nil, err
 		}
-		buf.Write(b[:])
 		if b[0] == delim {
 			break
 		}
+		buf.Write(b[:])
 	}
 	return buf.Bytes(), nil
 }
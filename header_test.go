@@ -0,0 +1,115 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestHeaderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Name = "naïve.txt"
+	w.Comment = "a comment"
+	w.Extra = []byte("extra field")
+	w.ModTime = time.Unix(1700000000, 0)
+	w.OS = 3
+	w.Write([]byte("data"))
+	w.Close()
+	input := buf.Bytes()
+
+	h, err := ReadHeader(NewBitReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(h.RawName) != "na\xefve.txt" || string(h.RawComment) != "a comment" {
+		t.Errorf("raw name %q and comment %q", h.RawName, h.RawComment)
+	}
+	if h.Name() != w.Name || h.Comment() != w.Comment || !h.ModTime().Equal(w.ModTime) || h.OS() != w.OS {
+		t.Errorf("header %q %q %v %d", h.Name(), h.Comment(), h.ModTime(), h.OS())
+	}
+	if want := 10 + 2 + len(w.Extra) + len(h.RawName) + 1 + len(h.RawComment) + 1; h.Size != want {
+		t.Errorf("size %d, want %d", h.Size, want)
+	}
+
+	// WriteHeader adds the terminating zero bytes back
+	var out bytes.Buffer
+	if err := WriteHeader(&out, h); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), input[:h.Size]) {
+		t.Errorf("wrote %q, want %q", out.Bytes(), input[:h.Size])
+	}
+
+	var empty Header
+	if empty.Name() != "" || empty.Comment() != "" || !empty.ModTime().IsZero() {
+		t.Errorf("empty header %q %q %v", empty.Name(), empty.Comment(), empty.ModTime())
+	}
+}
+
+// headerCrcData returns a gzip member of data whose header has FHCRC set
+// and holds crc16, or the correct CRC16 if crc16 is negative
+func headerCrcData(data []byte, crc16 int) []byte {
+	header := append([]byte{ID1, ID2, DEFLATE, FHCRC | FNAME, 0, 0, 0, 0, 0, 3}, "name\x00"...)
+	if crc16 < 0 {
+		crc16 = int(crc32.ChecksumIEEE(header) & 0xffff)
+	}
+	out := binary.LittleEndian.AppendUint16(header, uint16(crc16))
+	var deflate bytes.Buffer
+	w, _ := flate.NewWriter(&deflate, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+	out = append(out, deflate.Bytes()...)
+	out = binary.LittleEndian.AppendUint32(out, crc32.ChecksumIEEE(data))
+	return binary.LittleEndian.AppendUint32(out, uint32(len(data)))
+}
+
+func TestHeaderCrc(t *testing.T) {
+	data := []byte("data after a header with a CRC16")
+	valid := headerCrcData(data, -1)
+	h, err := ReadHeader(NewBitReader(bytes.NewReader(valid)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Size != 10+len("name\x00")+2 {
+		t.Errorf("header size %d", h.Size)
+	}
+	var out bytes.Buffer
+	if err := WriteHeader(&out, h); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), valid[:h.Size]) {
+		t.Errorf("wrote %q, want %q", out.Bytes(), valid[:h.Size])
+	}
+
+	wrong := headerCrcData(data, int(h.Crc16^1))
+	tests := []struct {
+		name   string
+		input  []byte
+		ignore bool
+		err    error
+	}{
+		{"valid", valid, false, nil},
+		{"mismatch", wrong, false, HeaderCrcMismatch},
+		{"mismatch ignored", wrong, true, nil},
+	}
+	for _, test := range tests {
+		r := NewDecompressorContainer(bytes.NewReader(test.input), GzipContainer{IgnoreHeaderCrc: test.ignore})
+		got, err := io.ReadAll(r)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+		if test.err == nil && !bytes.Equal(got, data) {
+			t.Errorf("%s: got %q", test.name, got)
+		}
+	}
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(wrong))); !errors.Is(err, HeaderCrcMismatch) {
+		t.Errorf("NewReader: got %v, want %v", err, HeaderCrcMismatch)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package gunzip
 
 import (
 	"math/bits"
@@ -22,6 +22,13 @@ func EmptyHuffmanDecoder() *HuffmanDecoder {
 }
 
 func NewHuffmanDecoder(codebook *Codebook) *HuffmanDecoder {
+	d := &HuffmanDecoder{}
+	d.build(codebook)
+	return d
+}
+
+// build sets up the decoder for codebook, reusing its lookup table
+func (d *HuffmanDecoder) build(codebook *Codebook) {
 	var nbits uint32
 	var secondaryMask uint32
 	if codebook.MaxLength > NUM_BITS_FIRST_LOOKUP {
@@ -32,7 +39,7 @@ func NewHuffmanDecoder(codebook *Codebook) *HuffmanDecoder {
 	}
 	var primaryMask uint32 = (1 << nbits) - 1
 
-	lookup := make([]SymbolLengthPair, 1<<nbits)
+	lookup := append(d.lookup[:0], make([]SymbolLengthPair, 1<<nbits)...)
 	for symbol, pair := range codebook.Book {
 		if pair.Length == 0 {
 			continue
@@ -51,9 +58,7 @@ func NewHuffmanDecoder(codebook *Codebook) *HuffmanDecoder {
 			if lookup[base].Symbol == 0 {
 				offset = uint32(len(lookup))
 				lookup[base] = SymbolLengthPair{offset, pair.Length}
-				newLen := len(lookup) + (1 << (codebook.MaxLength - nbits))
-				lookup = append(lookup, make([]SymbolLengthPair, newLen-len(lookup))...)
-
+				lookup = append(lookup, make([]SymbolLengthPair, 1<<(codebook.MaxLength-nbits))...)
 			} else {
 				offset = lookup[base].Symbol
 			}
@@ -67,18 +72,24 @@ func NewHuffmanDecoder(codebook *Codebook) *HuffmanDecoder {
 		}
 	}
 
-	return &HuffmanDecoder{lookup, primaryMask, secondaryMask}
+	d.lookup = lookup
+	d.primaryMask = primaryMask
+	d.secondaryMask = secondaryMask
 }
 
-func (d *HuffmanDecoder) Decode(bits uint32) (*SymbolLengthPair, error) {
+func (d *HuffmanDecoder) Decode(bits uint32) (SymbolLengthPair, error) {
 	pair := d.lookup[(bits & d.primaryMask)]
 	if pair.Length == 0 {
-		return nil, NewError(HuffmanDecoderCodeNotFound)
+		return pair, NewError(HuffmanDecoderCodeNotFound)
 	}
 	if pair.Length <= NUM_BITS_FIRST_LOOKUP {
-		return &pair, nil
+		return pair, nil
 	}
 	base := int(pair.Symbol)
 	idx := (bits >> NUM_BITS_FIRST_LOOKUP) & d.secondaryMask
-	return &d.lookup[base+int(idx)], nil
+	pair = d.lookup[base+int(idx)]
+	if pair.Length == 0 {
+		return pair, NewError(HuffmanDecoderCodeNotFound)
+	}
+	return pair, nil
 }
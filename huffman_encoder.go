@@ -0,0 +1,124 @@
+package gunzip
+
+import (
+	"math/bits"
+	"sort"
+)
+
+type HuffmanEncoder struct {
+	codes   []uint32 // bit reversed codes, ready to be written LSB first
+	lengths []uint32
+}
+
+func NewHuffmanEncoder(codebook *Codebook) *HuffmanEncoder {
+	codes := make([]uint32, len(codebook.Book))
+	lengths := make([]uint32, len(codebook.Book))
+	for symbol, pair := range codebook.Book {
+		if pair.Length == 0 {
+			continue
+		}
+		codes[symbol] = uint32(bits.Reverse16(uint16(pair.Bitcode))) >> (16 - pair.Length)
+		lengths[symbol] = pair.Length
+	}
+	return &HuffmanEncoder{codes, lengths}
+}
+
+func (e *HuffmanEncoder) Encode(w *BitWriter, symbol int) {
+	w.WriteBits(e.codes[symbol], int(e.lengths[symbol]))
+}
+
+// BitLength returns the number of bits needed to encode symbols with the
+// given frequencies
+func (e *HuffmanEncoder) BitLength(freqs []uint32) int {
+	n := 0
+	for symbol, freq := range freqs {
+		n += int(freq) * int(e.lengths[symbol])
+	}
+	return n
+}
+
+// BuildCodeLengths computes Huffman code lengths of at most maxLength bits for
+// the given symbol frequencies. At least two symbols are assigned a code so
+// that the code is always complete.
+func BuildCodeLengths(freqs []uint32, maxLength int) []uint32 {
+	lengths := make([]uint32, len(freqs))
+	symbols := make([]int, 0, len(freqs))
+	for symbol, freq := range freqs {
+		if freq > 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	for symbol := 0; len(symbols) < 2 && symbol < len(freqs); symbol++ {
+		if freqs[symbol] == 0 {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.SliceStable(symbols, func(i, j int) bool {
+		return freqs[symbols[i]] < freqs[symbols[j]]
+	})
+
+	// two-queue construction: leaves are sorted and internal nodes are created
+	// in non-decreasing order of weight
+	n := len(symbols)
+	weight := make([]uint64, 2*n-1)
+	parent := make([]int, 2*n-1)
+	for i, symbol := range symbols {
+		weight[i] = uint64(freqs[symbol])
+	}
+	leaf, node := 0, n
+	for next := n; next < 2*n-1; next++ {
+		for k := 0; k < 2; k++ {
+			var child int
+			if leaf < n && (node >= next || weight[leaf] <= weight[node]) {
+				child = leaf
+				leaf++
+			} else {
+				child = node
+				node++
+			}
+			weight[next] += weight[child]
+			parent[child] = next
+		}
+	}
+
+	// depth of each node, the root being the last one
+	depth := make([]int, 2*n-1)
+	var count [MAX_CODELENGTH + 2]int
+	for i := 2*n - 3; i >= 0; i-- {
+		depth[i] = depth[parent[i]] + 1
+		if i < n {
+			count[min(depth[i], maxLength+1)]++
+		}
+	}
+
+	// fold overlong codes into maxLength and restore the Kraft equality by
+	// lengthening shorter codes
+	if count[maxLength+1] > 0 {
+		count[maxLength] += count[maxLength+1]
+		count[maxLength+1] = 0
+		total := 0
+		for l := 1; l <= maxLength; l++ {
+			total += count[l] << (maxLength - l)
+		}
+		for ; total > 1<<maxLength; total-- {
+			count[maxLength]--
+			for l := maxLength - 1; l > 0; l-- {
+				if count[l] > 0 {
+					count[l]--
+					count[l+1] += 2
+					break
+				}
+			}
+		}
+	}
+
+	// least frequent symbols get the longest codes
+	i := 0
+	for l := maxLength; l > 0; l-- {
+		for k := 0; k < count[l]; k++ {
+			lengths[symbols[i]] = uint32(l)
+			i++
+		}
+	}
+	return lengths
+}
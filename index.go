@@ -0,0 +1,274 @@
+package gunzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// DefaultIndexSpan is the default distance in uncompressed bytes between
+// index checkpoints
+const DefaultIndexSpan = 1 << 20
+
+var indexMagic = [8]byte{'G', 'Z', 'I', 'D', 'X', 0, 0, 1}
+
+// Checkpoint is a point of a gzip stream where decoding can resume: a block
+// or member boundary together with the history needed to resolve matches
+type Checkpoint struct {
+	In     int64 // bit offset into the compressed stream
+	Out    int64 // offset into the uncompressed stream
+	State  State // StateHeader between members, StateBlock between blocks
+	Window []uint8
+}
+
+// Index lists checkpoints of a gzip stream in increasing order of offset
+type Index struct {
+	Span        int64 // minimum uncompressed distance between checkpoints
+	Size        int64 // total uncompressed size
+	Checkpoints []Checkpoint
+}
+
+// BuildIndex decodes the gzip stream read from reader and records a
+// checkpoint at the first boundary after every span bytes of output
+func BuildIndex(reader io.Reader, span int64) (*Index, error) {
+	if span <= 0 {
+		span = DefaultIndexSpan
+	}
+	bitreader := NewBitReader(reader)
+	producer := NewProducer(bitreader)
+	producer.borrow = true
+	index := &Index{Span: span, Checkpoints: []Checkpoint{{State: StateHeader}}}
+	var out int64
+	checksum := NewCrc32()
+	for {
+		produce, err := producer.Next()
+		if err != nil {
+			return nil, err
+		}
+		if produce == nil {
+			index.Size = out
+			return index, nil
+		}
+		if produce.Tag == ProduceData {
+			checksum.Update(produce.Data)
+			out += int64(len(produce.Data))
+		} else if produce.Tag == ProduceFooter {
+			if err := produce.Foot.Verify(checksum); err != nil {
+				return nil, producer.annotate(err)
+			}
+		}
+		last := &index.Checkpoints[len(index.Checkpoints)-1]
+		if producer.AtBoundary() && out-last.Out >= span {
+			index.Checkpoints = append(index.Checkpoints, Checkpoint{
+				In:     bitreader.BitOffset(),
+				Out:    out,
+				State:  producer.State(),
+				Window: append([]uint8(nil), producer.History()...),
+			})
+		}
+	}
+}
+
+// rebase makes the position in an error of a producer resumed at bit offset
+// in and output offset out absolute. The member and block indexes are
+// unknown and cleared.
+func rebase(err error, in, out int64) error {
+	if e, ok := err.(*Error); ok {
+		e.BitOffset += in
+		e.Offset += out
+		e.Member, e.Block = 0, 0
+	}
+	return err
+}
+
+// find returns the last checkpoint at or before offset
+func (idx *Index) find(offset int64) *Checkpoint {
+	i := sort.Search(len(idx.Checkpoints), func(i int) bool {
+		return idx.Checkpoints[i].Out > offset
+	})
+	return &idx.Checkpoints[max(i-1, 0)]
+}
+
+// WriteTo serializes the index to writer
+func (idx *Index) WriteTo(writer io.Writer) (int64, error) {
+	n := int64(0)
+	write := func(data any) error {
+		err := binary.Write(writer, binary.LittleEndian, data)
+		if err == nil {
+			n += int64(binary.Size(data))
+		}
+		return err
+	}
+	if err := write(indexMagic); err != nil {
+		return n, err
+	}
+	if err := write([]int64{idx.Span, idx.Size, int64(len(idx.Checkpoints))}); err != nil {
+		return n, err
+	}
+	for _, c := range idx.Checkpoints {
+		if err := write([]int64{c.In, c.Out, int64(c.State), int64(len(c.Window))}); err != nil {
+			return n, err
+		}
+		if err := write(c.Window); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ReadIndex deserializes an index written by Index.WriteTo
+func ReadIndex(reader io.Reader) (*Index, error) {
+	var magic [8]byte
+	if err := binary.Read(reader, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != indexMagic {
+		return nil, errors.New("gunzip: not an index file")
+	}
+	var head [3]int64
+	if err := binary.Read(reader, binary.LittleEndian, &head); err != nil {
+		return nil, err
+	}
+	idx := &Index{Span: head[0], Size: head[1]}
+	if head[2] < 1 || head[1] < 0 {
+		return nil, errors.New("gunzip: invalid index file")
+	}
+	for i := int64(0); i < head[2]; i++ {
+		var fields [4]int64
+		if err := binary.Read(reader, binary.LittleEndian, &fields); err != nil {
+			return nil, err
+		}
+		c := Checkpoint{In: fields[0], Out: fields[1], State: State(fields[2])}
+		if c.State != StateHeader && c.State != StateBlock || fields[3] < 0 || fields[3] > MAX_DISTANCE {
+			return nil, errors.New("gunzip: invalid index file")
+		}
+		if i > 0 && c.Out < idx.Checkpoints[i-1].Out {
+			return nil, errors.New("gunzip: invalid index file")
+		}
+		c.Window = make([]uint8, fields[3])
+		if _, err := io.ReadFull(reader, c.Window); err != nil {
+			return nil, err
+		}
+		idx.Checkpoints = append(idx.Checkpoints, c)
+	}
+	return idx, nil
+}
+
+// IndexedReader gives random access to the uncompressed content of a gzip
+// stream, decoding from the checkpoint nearest to each requested offset.
+// Sequential reads continue where the previous one stopped.
+type IndexedReader struct {
+	input  io.ReaderAt
+	size   int64
+	index  *Index
+	offset int64 // position for Read and Seek
+
+	mu       sync.Mutex
+	producer *Producer
+	resumed  *Checkpoint // where producer started
+	pending  []uint8     // decoded data not yet returned
+	pos      int64       // uncompressed offset of pending[0]
+}
+
+// NewIndexedReader returns a reader over the gzip stream of the given size in
+// input, as described by index
+func NewIndexedReader(input io.ReaderAt, size int64, index *Index) *IndexedReader {
+	return &IndexedReader{input: input, size: size, index: index}
+}
+
+// Size returns the uncompressed size of the stream
+func (r *IndexedReader) Size() int64 {
+	return r.index.Size
+}
+
+// resume restarts decoding from the checkpoint nearest to offset
+func (r *IndexedReader) resume(offset int64) error {
+	c := r.index.find(offset)
+	if c.In < 0 || c.In > r.size*8 {
+		return errors.New("gunzip: index does not match input")
+	}
+	bitreader := NewBitReader(io.NewSectionReader(r.input, c.In/8, r.size-c.In/8))
+	if bits := int(c.In % 8); bits > 0 {
+		if _, err := bitreader.ReadBits(bits); err != nil {
+			return err
+		}
+	}
+	r.producer = ResumeProducer(bitreader, c.State, c.Window)
+	// pending is used up before the producer is advanced
+	r.producer.borrow = true
+	r.resumed = c
+	r.pending = nil
+	r.pos = c.Out
+	return nil
+}
+
+// ReadAt implements io.ReaderAt
+func (r *IndexedReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gunzip: negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.producer == nil || off < r.pos || r.index.find(off).Out > r.pos+int64(len(r.pending)) {
+		if err := r.resume(off); err != nil {
+			return 0, err
+		}
+	}
+	n := 0
+	for n < len(p) {
+		if off < r.pos+int64(len(r.pending)) {
+			m := copy(p[n:], r.pending[off-r.pos:])
+			n += m
+			off += int64(m)
+			continue
+		}
+		r.pos += int64(len(r.pending))
+		r.pending = nil
+		produce, err := r.producer.Next()
+		if err != nil {
+			r.producer = nil
+			return n, rebase(err, r.resumed.In-r.resumed.In%8, r.resumed.Out)
+		}
+		if produce == nil {
+			return n, io.EOF
+		}
+		if produce.Tag == ProduceData {
+			r.pending = produce.Data
+		}
+	}
+	return n, nil
+}
+
+// Read implements io.Reader
+func (r *IndexedReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *IndexedReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.index.Size
+	default:
+		return 0, errors.New("gunzip: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("gunzip: negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
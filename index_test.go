@@ -0,0 +1,156 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestIndexedReaderReadAt(t *testing.T) {
+	data := parallelInput()[:2<<20]
+	half := len(data) / 2
+	inputs := map[string][]byte{
+		"single":  gzipLevel(t, data, gzip.DefaultCompression),
+		"members": append(gzipLevel(t, data[:half], gzip.BestSpeed), gzipLevel(t, data[half:], gzip.NoCompression)...),
+	}
+	for name, input := range inputs {
+		index, err := BuildIndex(bytes.NewReader(input), 64<<10)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if index.Size != int64(len(data)) || len(index.Checkpoints) < 16 {
+			t.Fatalf("%s: size %d with %d checkpoints", name, index.Size, len(index.Checkpoints))
+		}
+		r := NewIndexedReader(bytes.NewReader(input), int64(len(input)), index)
+		rng := rand.New(rand.NewSource(3))
+		for i := 0; i < 50; i++ {
+			off := rng.Int63n(int64(len(data)))
+			buf := make([]byte, rng.Intn(100000))
+			n, err := r.ReadAt(buf, off)
+			want := data[off:min(off+int64(len(buf)), int64(len(data)))]
+			if !bytes.Equal(buf[:n], want) {
+				t.Fatalf("%s: ReadAt(%d, %d) returned different data", name, len(buf), off)
+			}
+			if n < len(buf) && err != io.EOF {
+				t.Fatalf("%s: short ReadAt with error %v", name, err)
+			}
+		}
+	}
+}
+
+func TestIndexedReaderSeek(t *testing.T) {
+	data := parallelInput()[:1<<20]
+	input := gzipLevel(t, data, gzip.DefaultCompression)
+	index, err := BuildIndex(bytes.NewReader(input), 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewIndexedReader(bytes.NewReader(input), int64(len(input)), index)
+	if _, err := r.Seek(-1000, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, data[len(data)-1000:]) {
+		t.Fatalf("read %d bytes from the end: %v", len(got), err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seek to a negative position succeeded")
+	}
+}
+
+func TestIndexSerialization(t *testing.T) {
+	data := parallelInput()[:1<<20]
+	input := gzipLevel(t, data, gzip.DefaultCompression)
+	index, err := BuildIndex(bytes.NewReader(input), 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := index.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	saved := buf.Bytes()
+	loaded, err := ReadIndex(bytes.NewReader(saved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Size != index.Size || loaded.Span != index.Span || len(loaded.Checkpoints) != len(index.Checkpoints) {
+		t.Fatalf("loaded index differs: %d %d %d", loaded.Size, loaded.Span, len(loaded.Checkpoints))
+	}
+	r := NewIndexedReader(bytes.NewReader(input), int64(len(input)), loaded)
+	got := make([]byte, 5000)
+	if _, err := r.ReadAt(got, 700000); err != nil || !bytes.Equal(got, data[700000:705000]) {
+		t.Fatalf("ReadAt with the loaded index: %v", err)
+	}
+
+	for _, corrupt := range [][]byte{saved[:len(saved)/2], append([]byte("NOTANIDX"), saved[8:]...)} {
+		if _, err := ReadIndex(bytes.NewReader(corrupt)); err == nil {
+			t.Error("corrupt index loaded")
+		}
+	}
+}
+
+func TestBuildIndexErrors(t *testing.T) {
+	input := gzipLevel(t, parallelInput()[:1<<20], gzip.DefaultCompression)
+	crc := append([]byte(nil), input...)
+	crc[len(crc)-8] ^= 1
+	tests := []struct {
+		name  string
+		input []byte
+		kind  error
+	}{
+		{"crc", crc, ChecksumMismatch},
+		{"truncated", input[:len(input)/2], io.ErrUnexpectedEOF},
+		{"empty", nil, EmptyInput},
+	}
+	for _, test := range tests {
+		if _, err := BuildIndex(bytes.NewReader(test.input), 0); !errors.Is(err, test.kind) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.kind)
+		}
+	}
+}
+
+func TestIndexedReaderTruncatedInput(t *testing.T) {
+	input := gzipLevel(t, parallelInput()[:1<<20], gzip.DefaultCompression)
+	index, err := BuildIndex(bytes.NewReader(input), 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the input was cut after the index was built
+	truncated := input[:len(input)*3/4]
+	r := NewIndexedReader(bytes.NewReader(truncated), int64(len(truncated)), index)
+	_, err = r.ReadAt(make([]byte, 300000), 700000)
+	var e *Error
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !errors.As(err, &e) || e.BitOffset < int64(len(input)) {
+		t.Fatalf("got %v, want unexpected EOF at its offset in the input", err)
+	}
+}
+
+func TestIndexedReaderConcurrentReadAt(t *testing.T) {
+	data := parallelInput()[:1<<20]
+	input := gzipLevel(t, data, gzip.DefaultCompression)
+	index, err := BuildIndex(bytes.NewReader(input), 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewIndexedReader(bytes.NewReader(input), int64(len(input)), index)
+	errs := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func(off int64) {
+			buf := make([]byte, 10000)
+			_, err := r.ReadAt(buf, off)
+			if err == nil && !bytes.Equal(buf, data[off:off+10000]) {
+				err = errors.New("ReadAt returned different data")
+			}
+			errs <- err
+		}(int64(i) * 200000)
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
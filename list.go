@@ -0,0 +1,64 @@
+package gunzip
+
+import (
+	"io"
+)
+
+// Member describes one member of a gzip stream
+type Member struct {
+	Header           *Header
+	Footer           *Footer // nil for compress and pack members
+	Offset           int64   // byte offset of the member within the stream
+	CompressedSize   int64   // size of the member including header and footer
+	UncompressedSize uint64  // decoded size, not truncated to 32 bits like ISIZE
+}
+
+// Ratio returns the space saving of the member in percent, as reported by
+// gzip -l
+func (m *Member) Ratio() float64 {
+	if m.UncompressedSize == 0 {
+		return 0
+	}
+	return 100 * (float64(m.UncompressedSize) - float64(m.CompressedSize)) / float64(m.UncompressedSize)
+}
+
+// List walks every member of the gzip stream read from reader. Each member is
+// decoded in order to count its true uncompressed size; the data itself is
+// discarded. Compress and pack members have no footer, and end where the next
+// member or the input does.
+func List(reader io.Reader) ([]Member, error) {
+	bitreader := NewBitReader(reader)
+	producer := NewProducer(bitreader)
+	producer.borrow = true
+	members := make([]Member, 0)
+	var member Member
+	// endLegacy appends the legacy member being listed, which ends at offset
+	endLegacy := func(offset int64) {
+		if member.Header != nil && member.Header.IsLegacy() {
+			member.CompressedSize = offset - member.Offset
+			members = append(members, member)
+		}
+	}
+	for {
+		produce, err := producer.Next()
+		if err != nil {
+			return members, err
+		}
+		if produce == nil {
+			endLegacy(bitreader.Offset())
+			return members, nil
+		}
+		if produce.Tag == ProduceHeader {
+			// the end of a legacy member is only found when reading on
+			offset := bitreader.Offset() - int64(produce.Head.Size)
+			endLegacy(offset)
+			member = Member{Header: produce.Head, Offset: offset}
+		} else if produce.Tag == ProduceFooter {
+			member.Footer = produce.Foot
+			member.CompressedSize = bitreader.Offset() - member.Offset
+			members = append(members, member)
+		} else if produce.Tag == ProduceData {
+			member.UncompressedSize += uint64(len(produce.Data))
+		}
+	}
+}
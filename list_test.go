@@ -0,0 +1,81 @@
+package gunzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	text, zeros := testInputs()["text"], make([]byte, 1<<20)
+	first, second := gzipData(t, text), gzipData(t, zeros)
+	badCrc := bytes.Clone(first)
+	badCrc[len(badCrc)-8] ^= 1
+	tests := []struct {
+		name  string
+		input []byte
+		sizes []int // uncompressed size of each member
+		err   error
+	}{
+		{"single", first, []int{len(text)}, nil},
+		{"multi-member", append(bytes.Clone(first), second...), []int{len(text), len(zeros)}, nil},
+		// listing does not verify checksums, as with gzip -l
+		{"bad crc", badCrc, []int{len(text)}, nil},
+		{"trailing garbage", append(bytes.Clone(first), "garbage"...), []int{len(text)}, TrailingGarbage},
+		{"truncated", append(bytes.Clone(first), second[:len(second)/2]...), []int{len(text)}, io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		members, err := List(bytes.NewReader(test.input))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+		if len(members) != len(test.sizes) {
+			t.Fatalf("%s: %d members, want %d", test.name, len(members), len(test.sizes))
+		}
+		offset := int64(0)
+		for i, m := range members {
+			size := uint64(test.sizes[i])
+			if m.Offset != offset || m.UncompressedSize != size || uint64(m.Footer.Size) != size {
+				t.Errorf("%s: member %d at %d of size %d, ISIZE %d", test.name, i+1, m.Offset, m.UncompressedSize, m.Footer.Size)
+			}
+			want := 100 * (float64(size) - float64(m.CompressedSize)) / float64(size)
+			if m.Ratio() != want || m.Ratio() <= 0 {
+				t.Errorf("%s: member %d ratio %v, want %v", test.name, i+1, m.Ratio(), want)
+			}
+			offset += m.CompressedSize
+		}
+		if test.err == nil && offset != int64(len(test.input)) {
+			t.Errorf("%s: members cover %d bytes of %d", test.name, offset, len(test.input))
+		}
+	}
+
+	empty := Member{CompressedSize: 20}
+	if empty.Ratio() != 0 {
+		t.Errorf("ratio of an empty member %v", empty.Ratio())
+	}
+}
+
+func TestListLegacy(t *testing.T) {
+	parts := [][]byte{[]byte("gzip\n"), []byte("pack\n"), []byte("gzip again\n"), []byte("compress\n")}
+	encoded := [][]byte{gzipData(t, parts[0]), packEncode(parts[1]), gzipData(t, parts[2]), lzwEncode(parts[3], 16, true)}
+	input := bytes.Join(encoded, nil)
+
+	members, err := List(bytes.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != len(parts) {
+		t.Fatalf("%d members, want %d", len(members), len(parts))
+	}
+	offset := int64(0)
+	for i, m := range members {
+		if m.Offset != offset || m.CompressedSize != int64(len(encoded[i])) || m.UncompressedSize != uint64(len(parts[i])) {
+			t.Errorf("member %d: offset %d, sizes %d and %d", i+1, m.Offset, m.CompressedSize, m.UncompressedSize)
+		}
+		if (m.Footer == nil) != m.Header.IsLegacy() {
+			t.Errorf("member %d: footer %v", i+1, m.Footer)
+		}
+		offset += int64(len(encoded[i]))
+	}
+}
@@ -1,8 +1,21 @@
-package main
+package gunzip
 
 const END_OF_BLOCK = 256
 const MAX_DISTANCE = 1 << 15 // 32kB
 const MAX_LENGTH = 258
+const MAX_DISTANCE64 = 1 << 16 // 64kB for Deflate64
+const MAX_LENGTH64 = 65538
+
+// Format holds the parameters in which Deflate64 differs from deflate
+type Format struct {
+	MaxDistance int
+	MaxLength   int
+	Lengths     [][2]uint32 // extra bits and base of the length symbols
+	Distances   [][2]uint32 // extra bits and base of the distance symbols
+}
+
+var DeflateFormat = &Format{MAX_DISTANCE, MAX_LENGTH, SYMBOL2BITS_LENGTH, SYMBOL2BITS_DISTANCE}
+var Deflate64Format = &Format{MAX_DISTANCE64, MAX_LENGTH64, SYMBOL2BITS_LENGTH64, SYMBOL2BITS_DISTANCE64}
 
 type Code uint8
 
@@ -15,8 +28,8 @@ const (
 type CodeData struct {
 	Tag      Code
 	Value    uint8
-	Distance uint16
-	Length   uint16
+	Distance uint32
+	Length   uint32
 }
 
 func NewLiteral(value uint8) CodeData {
@@ -27,7 +40,7 @@ func NewEndOfBlock() CodeData {
 	return CodeData{EndOfBlock, 0, 0, 0}
 }
 
-func NewDictionary(length uint16, distance uint16) CodeData {
+func NewDictionary(length uint32, distance uint32) CodeData {
 	return CodeData{Dictionary, 0, distance, length}
 }
 
@@ -43,15 +56,20 @@ type DecodeResult struct {
 	N   uint32
 }
 
-func Decode(window []uint8, boundary int, reader BitRead, llDecoder *HuffmanDecoder, distDecoder *HuffmanDecoder) (*DecodeResult, error) {
+func Decode(window []uint8, boundary int, reader BitRead, llDecoder *HuffmanDecoder, distDecoder *HuffmanDecoder) (DecodeResult, error) {
+	return DecodeFormat(DeflateFormat, window, boundary, reader, llDecoder, distDecoder)
+}
+
+// DecodeFormat is like Decode for data in the given format
+func DecodeFormat(format *Format, window []uint8, boundary int, reader BitRead, llDecoder *HuffmanDecoder, distDecoder *HuffmanDecoder) (DecodeResult, error) {
 	idx := boundary
-	if idx+MAX_LENGTH >= len(window) {
-		return &DecodeResult{WindowsIsFull, uint32(idx - boundary)}, nil
+	if idx+format.MaxLength >= len(window) {
+		return DecodeResult{WindowsIsFull, uint32(idx - boundary)}, nil
 	}
 	for {
-		code, err := ReadNextCode(reader, llDecoder, distDecoder)
+		code, err := ReadNextCodeFormat(format, reader, llDecoder, distDecoder)
 		if err != nil {
-			return nil, err
+			return DecodeResult{}, err
 		}
 		if code.Tag == Literal {
 			window[idx] = code.Value
@@ -60,7 +78,7 @@ func Decode(window []uint8, boundary int, reader BitRead, llDecoder *HuffmanDeco
 			distance := int(code.Distance)
 			length := int(code.Length)
 			if distance > idx {
-				return nil, NewError(DistanceTooMuch)
+				return DecodeResult{}, NewError(DistanceTooMuch)
 			}
 			begin := idx - distance
 			for length > 0 {
@@ -71,15 +89,20 @@ func Decode(window []uint8, boundary int, reader BitRead, llDecoder *HuffmanDeco
 				distance += n
 			}
 		} else if code.Tag == EndOfBlock {
-			return &DecodeResult{Done, uint32(idx - boundary)}, nil
+			return DecodeResult{Done, uint32(idx - boundary)}, nil
 		}
-		if idx+MAX_LENGTH >= len(window) {
-			return &DecodeResult{WindowsIsFull, uint32(idx - boundary)}, nil
+		if idx+format.MaxLength >= len(window) {
+			return DecodeResult{WindowsIsFull, uint32(idx - boundary)}, nil
 		}
 	}
 }
 
 func ReadNextCode(reader BitRead, llDecoder *HuffmanDecoder, distDecoder *HuffmanDecoder) (CodeData, error) {
+	return ReadNextCodeFormat(DeflateFormat, reader, llDecoder, distDecoder)
+}
+
+// ReadNextCodeFormat is like ReadNextCode for data in the given format
+func ReadNextCodeFormat(format *Format, reader BitRead, llDecoder *HuffmanDecoder, distDecoder *HuffmanDecoder) (CodeData, error) {
 	bitcode, err := reader.PeekBits()
 	if err != nil {
 		return CodeData{}, err
@@ -94,7 +117,10 @@ func ReadNextCode(reader BitRead, llDecoder *HuffmanDecoder, distDecoder *Huffma
 	} else if pair.Symbol < END_OF_BLOCK {
 		return NewLiteral(uint8(pair.Symbol)), nil
 	}
-	bitsLength := SYMBOL2BITS_LENGTH[int(pair.Symbol&0xFF)]
+	if int(pair.Symbol&0xFF) >= len(format.Lengths) {
+		return CodeData{}, NewError(HuffmanDecoderCodeNotFound)
+	}
+	bitsLength := format.Lengths[int(pair.Symbol&0xFF)]
 	length, err := reader.ReadBits(int(bitsLength[0]))
 	if err != nil {
 		return CodeData{}, err
@@ -109,13 +135,16 @@ func ReadNextCode(reader BitRead, llDecoder *HuffmanDecoder, distDecoder *Huffma
 		return CodeData{}, err
 	}
 	reader.Consume(int(pair.Length))
-	bitsDistance := SYMBOL2BITS_DISTANCE[int(pair.Symbol)]
+	if int(pair.Symbol) >= len(format.Distances) {
+		return CodeData{}, NewError(HuffmanDecoderCodeNotFound)
+	}
+	bitsDistance := format.Distances[int(pair.Symbol)]
 	dist, err := reader.ReadBits(int(bitsDistance[0]))
 	if err != nil {
 		return CodeData{}, err
 	}
 	bitsDistance[1] += dist
-	return NewDictionary(uint16(bitsLength[1]), uint16(bitsDistance[1])), nil
+	return NewDictionary(bitsLength[1], bitsDistance[1]), nil
 }
 
 var SYMBOL2BITS_LENGTH = [][2]uint32{
@@ -183,3 +212,74 @@ var SYMBOL2BITS_DISTANCE = [][2]uint32{
 	{13, 16385},
 	{13, 24577},
 }
+
+// SYMBOL2BITS_LENGTH64 differs from SYMBOL2BITS_LENGTH in symbol 285, which
+// takes 16 extra bits on top of a base of 3
+var SYMBOL2BITS_LENGTH64 = [][2]uint32{
+	{0, 0},
+	{0, 3},
+	{0, 4},
+	{0, 5},
+	{0, 6},
+	{0, 7},
+	{0, 8},
+	{0, 9},
+	{0, 10},
+	{1, 11},
+	{1, 13},
+	{1, 15},
+	{1, 17},
+	{2, 19},
+	{2, 23},
+	{2, 27},
+	{2, 31},
+	{3, 35},
+	{3, 43},
+	{3, 51},
+	{3, 59},
+	{4, 67},
+	{4, 83},
+	{4, 99},
+	{4, 115},
+	{5, 131},
+	{5, 163},
+	{5, 195},
+	{5, 227},
+	{16, 3},
+}
+
+// SYMBOL2BITS_DISTANCE64 adds the distance codes 30 and 31 of Deflate64
+var SYMBOL2BITS_DISTANCE64 = [][2]uint32{
+	{0, 1},
+	{0, 2},
+	{0, 3},
+	{0, 4},
+	{1, 5},
+	{1, 7},
+	{2, 9},
+	{2, 13},
+	{3, 17},
+	{3, 25},
+	{4, 33},
+	{4, 49},
+	{5, 65},
+	{5, 97},
+	{6, 129},
+	{6, 193},
+	{7, 257},
+	{7, 385},
+	{8, 513},
+	{8, 769},
+	{9, 1025},
+	{9, 1537},
+	{10, 2049},
+	{10, 3073},
+	{11, 4097},
+	{11, 6145},
+	{12, 8193},
+	{12, 12289},
+	{13, 16385},
+	{13, 24577},
+	{14, 32769},
+	{14, 49153},
+}
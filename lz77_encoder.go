@@ -0,0 +1,181 @@
+package gunzip
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const MIN_MATCH = 3
+
+// matches of MIN_MATCH bytes farther than this cost more than the literals
+const TOO_FAR = 4096
+
+const hashBits = 15
+const hashSize = 1 << hashBits
+const windowMask = MAX_DISTANCE - 1
+
+// lengthSymbol maps length-MIN_MATCH to an index into SYMBOL2BITS_LENGTH
+var lengthSymbol [MAX_LENGTH - MIN_MATCH + 1]uint8
+
+// distSymbol maps distance-1 to an index into SYMBOL2BITS_DISTANCE, directly
+// below 256 and by distance-1 >> 7 above
+var distSymbol [512]uint8
+
+func init() {
+	for idx := 1; idx < len(SYMBOL2BITS_LENGTH); idx++ {
+		nbits, base := SYMBOL2BITS_LENGTH[idx][0], SYMBOL2BITS_LENGTH[idx][1]
+		for length := base; length < base+(1<<nbits) && length <= MAX_LENGTH; length++ {
+			// length 258 has its own symbol
+			if length == MAX_LENGTH && idx != len(SYMBOL2BITS_LENGTH)-1 {
+				continue
+			}
+			lengthSymbol[length-MIN_MATCH] = uint8(idx)
+		}
+	}
+	for idx, pair := range SYMBOL2BITS_DISTANCE {
+		nbits, base := pair[0], pair[1]
+		for dist := base - 1; dist < base-1+(1<<nbits); dist++ {
+			if dist < 256 {
+				distSymbol[dist] = uint8(idx)
+			} else {
+				distSymbol[256+dist>>7] = uint8(idx)
+			}
+		}
+	}
+}
+
+// LengthSymbol returns the index into SYMBOL2BITS_LENGTH for a match length
+func LengthSymbol(length int) int {
+	return int(lengthSymbol[length-MIN_MATCH])
+}
+
+// DistanceSymbol returns the distance code for a match distance
+func DistanceSymbol(distance int) int {
+	if distance <= 256 {
+		return int(distSymbol[distance-1])
+	}
+	return int(distSymbol[256+(distance-1)>>7])
+}
+
+// compressionConfig tunes the match finder, following zlib's configuration
+// table
+type compressionConfig struct {
+	good   int  // reduce the search when the previous match is this long
+	lazy   int  // do not look for a better match beyond this length (greedy: do not index longer matches)
+	nice   int  // stop searching once a match this long is found
+	chain  int  // maximum number of hash chain entries to examine
+	isLazy bool // defer emitting a match to see whether the next one is better
+}
+
+var compressionConfigs = [10]compressionConfig{
+	{0, 0, 0, 0, false},
+	{4, 4, 8, 4, false},
+	{4, 5, 16, 8, false},
+	{4, 6, 32, 32, false},
+	{4, 4, 16, 16, true},
+	{8, 16, 32, 32, true},
+	{8, 16, 128, 128, true},
+	{8, 32, 128, 256, true},
+	{32, 128, 258, 1024, true},
+	{32, 258, 258, 4096, true},
+}
+
+// MatchFinder locates earlier occurrences of byte strings with hash chains
+type MatchFinder struct {
+	config compressionConfig
+	head   []int32 // hash -> most recent position + 1
+	prev   []int32 // position & windowMask -> previous position + 1 with the same hash
+}
+
+func NewMatchFinder(level int) *MatchFinder {
+	return &MatchFinder{
+		config: compressionConfigs[level],
+		head:   make([]int32, hashSize),
+		prev:   make([]int32, MAX_DISTANCE),
+	}
+}
+
+// Reset forgets all indexed positions
+func (m *MatchFinder) Reset() {
+	clear(m.head)
+	clear(m.prev)
+}
+
+func hash3(b []uint8) uint32 {
+	return (uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])) * 0x9E3779B1 >> (32 - hashBits)
+}
+
+// Insert indexes the string starting at data[pos]
+func (m *MatchFinder) Insert(data []uint8, pos int) {
+	if pos+MIN_MATCH > len(data) {
+		return
+	}
+	h := hash3(data[pos:])
+	m.prev[pos&windowMask] = m.head[h]
+	m.head[h] = int32(pos + 1)
+}
+
+// Find returns the longest match for data[pos:] that is longer than
+// minLength, or 0 if there is none
+func (m *MatchFinder) Find(data []uint8, pos int, minLength int) (length int, distance int) {
+	if pos+MIN_MATCH > len(data) {
+		return 0, 0
+	}
+	chain := m.config.chain
+	if minLength >= m.config.good {
+		chain >>= 2
+	}
+	maxLength := min(MAX_LENGTH, len(data)-pos)
+	nice := min(m.config.nice, maxLength)
+	best := minLength
+	limit := pos - MAX_DISTANCE
+
+	cand := int(m.head[hash3(data[pos:])]) - 1
+	for cand >= 0 && cand >= limit && cand < pos && chain > 0 {
+		if best < maxLength && data[cand+best] == data[pos+best] {
+			l := matchLength(data[cand:cand+maxLength], data[pos:pos+maxLength])
+			if l > best {
+				best, length, distance = l, l, pos-cand
+				if l >= nice {
+					break
+				}
+			}
+		}
+		next := int(m.prev[cand&windowMask]) - 1
+		if next >= cand {
+			break
+		}
+		cand = next
+		chain--
+	}
+	return length, distance
+}
+
+// Rebase shifts all indexed positions down by delta, a multiple of
+// MAX_DISTANCE, dropping those that fall off
+func (m *MatchFinder) Rebase(delta int) {
+	for _, table := range [][]int32{m.head, m.prev} {
+		for i, v := range table {
+			if int(v) > delta {
+				table[i] = v - int32(delta)
+			} else {
+				table[i] = 0
+			}
+		}
+	}
+}
+
+func matchLength(a, b []uint8) int {
+	n := 0
+	for n+8 <= len(a) {
+		x := binary.LittleEndian.Uint64(a[n:]) ^ binary.LittleEndian.Uint64(b[n:])
+		if x != 0 {
+			return n + bits.TrailingZeros64(x)/8
+		}
+		n += 8
+	}
+	for n < len(a) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,170 @@
+package gunzip
+
+import (
+	"io"
+)
+
+const (
+	LZW_BITS_MASK  = 0x1f
+	LZW_BLOCK_MODE = 0x80
+	LZW_INIT_BITS  = 9
+	LZW_MAX_BITS   = 16
+	LZW_CLEAR      = 256
+)
+
+// legacyChunkSize is the amount of output the legacy decoders gather before
+// returning it
+const legacyChunkSize = 1 << 16
+
+// LzwDecoder decodes the data of a compress (.Z) file following its magic
+// bytes, mirroring the unlzw of GNU gzip
+type LzwDecoder struct {
+	reader     io.Reader
+	started    bool
+	done       bool
+	maxBits    int
+	blockMode  bool
+	nBits      int
+	maxCode    int
+	maxMaxCode int
+	freeEnt    int
+	oldCode    int
+	finChar    uint8
+	prefix     []uint16
+	suffix     []uint8
+	stack      []uint8
+	group      []uint8
+	out        []uint8 // returned by Next, reused by the following call
+}
+
+func NewLzwDecoder(reader io.Reader) *LzwDecoder {
+	return &LzwDecoder{
+		reader: reader,
+		prefix: make([]uint16, 1<<LZW_MAX_BITS),
+		suffix: make([]uint8, 1<<LZW_MAX_BITS),
+		stack:  make([]uint8, 0, 1<<LZW_MAX_BITS),
+		group:  make([]uint8, LZW_MAX_BITS+2), // padded for reading the last code
+		out:    make([]uint8, 0, legacyChunkSize+1<<LZW_MAX_BITS),
+	}
+}
+
+// Reset makes the decoder decode new data from reader, keeping its tables
+func (d *LzwDecoder) Reset(reader io.Reader) {
+	d.reader = reader
+	d.started = false
+	d.done = false
+}
+
+func (d *LzwDecoder) readFlags() error {
+	var flags [1]uint8
+	if _, err := io.ReadFull(d.reader, flags[:]); err != nil {
+		return eofIsUnexpected(err)
+	}
+	d.maxBits = int(flags[0] & LZW_BITS_MASK)
+	d.blockMode = flags[0]&LZW_BLOCK_MODE != 0
+	if d.maxBits < LZW_INIT_BITS || d.maxBits > LZW_MAX_BITS {
+		return NewError(InvalidLzwData)
+	}
+	d.maxMaxCode = 1 << d.maxBits
+	d.nBits = LZW_INIT_BITS
+	d.maxCode = 1<<d.nBits - 1
+	d.freeEnt = 256
+	if d.blockMode {
+		d.freeEnt = LZW_CLEAR + 1
+	}
+	d.oldCode = -1
+	d.started = true
+	return nil
+}
+
+// Next returns the next chunk of decoded data, which stays valid until the
+// next call, or io.EOF once the input is exhausted
+func (d *LzwDecoder) Next() ([]uint8, error) {
+	if !d.started {
+		if err := d.readFlags(); err != nil {
+			return nil, err
+		}
+	}
+	// a chunk ends at most one string of the dictionary past legacyChunkSize
+	out := d.out[:0]
+	for !d.done && len(out) < legacyChunkSize {
+		if d.freeEnt > d.maxCode {
+			d.nBits++
+			if d.nBits == d.maxBits {
+				d.maxCode = d.maxMaxCode
+			} else {
+				d.maxCode = 1<<d.nBits - 1
+			}
+		}
+		// codes come in groups of eight, filling nBits bytes; a change of
+		// the code size discards the rest of the group
+		n, err := io.ReadFull(d.reader, d.group[:d.nBits])
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			d.done = true
+		} else if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n*8/d.nBits; i++ {
+			pos := i * d.nBits
+			bits := uint32(d.group[pos/8]) | uint32(d.group[pos/8+1])<<8 | uint32(d.group[pos/8+2])<<16
+			code := int(bits>>(pos%8)) & (1<<d.nBits - 1)
+			if code == LZW_CLEAR && d.blockMode && d.oldCode != -1 {
+				d.freeEnt = LZW_CLEAR
+				d.nBits = LZW_INIT_BITS
+				d.maxCode = 1<<d.nBits - 1
+				break
+			}
+			out, err = d.decode(code, out)
+			if err != nil {
+				return nil, err
+			}
+			if d.freeEnt > d.maxCode {
+				break
+			}
+		}
+	}
+	d.out = out
+	if len(out) == 0 && d.done {
+		return nil, io.EOF
+	}
+	return out, nil
+}
+
+// decode appends the string of a code to out and extends the dictionary
+func (d *LzwDecoder) decode(code int, out []uint8) ([]uint8, error) {
+	if d.oldCode == -1 {
+		if code >= 256 {
+			return nil, NewError(InvalidLzwData)
+		}
+		d.oldCode = code
+		d.finChar = uint8(code)
+		return append(out, d.finChar), nil
+	}
+	inCode := code
+	stack := d.stack[:0]
+	if code >= d.freeEnt {
+		// the code being defined: the previous string plus its first byte
+		if code > d.freeEnt {
+			return nil, NewError(InvalidLzwData)
+		}
+		stack = append(stack, d.finChar)
+		code = d.oldCode
+	}
+	for code >= 256 {
+		stack = append(stack, d.suffix[code])
+		code = int(d.prefix[code])
+	}
+	d.finChar = uint8(code)
+	stack = append(stack, d.finChar)
+	for i := len(stack) - 1; i >= 0; i-- {
+		out = append(out, stack[i])
+	}
+
+	if d.freeEnt < d.maxMaxCode {
+		d.prefix[d.freeEnt] = uint16(d.oldCode)
+		d.suffix[d.freeEnt] = d.finChar
+		d.freeEnt++
+	}
+	d.oldCode = inCode
+	return out, nil
+}
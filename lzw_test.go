@@ -0,0 +1,174 @@
+package gunzip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// lzwEncode compresses data in the format of compress, including its habit
+// of padding the group of eight codes being written when the code size
+// changes
+func lzwEncode(data []byte, maxBits int, blockMode bool) []byte {
+	flags := uint8(maxBits)
+	if blockMode {
+		flags |= LZW_BLOCK_MODE
+	}
+	out := []byte{ID1, LZW_ID2, flags}
+	nBits, maxCode, maxMaxCode := LZW_INIT_BITS, 1<<LZW_INIT_BITS-1, 1<<maxBits
+	freeEnt := 256
+	if blockMode {
+		freeEnt = LZW_CLEAR + 1
+	}
+	group := make([]byte, LZW_MAX_BITS) // eight codes of nBits
+	pos := 0
+	reset := false
+	flushGroup := func() {
+		if pos > 0 {
+			out = append(out, group[:nBits]...)
+		}
+		clear(group)
+		pos = 0
+	}
+	output := func(code int) {
+		for i := 0; i < nBits; i++ {
+			group[(pos+i)/8] |= uint8(code>>i&1) << ((pos + i) % 8)
+		}
+		pos += nBits
+		if pos == 8*nBits {
+			flushGroup()
+		}
+		if freeEnt > maxCode || reset {
+			flushGroup()
+			if reset {
+				nBits, maxCode, reset = LZW_INIT_BITS, 1<<LZW_INIT_BITS-1, false
+			} else {
+				nBits++
+				maxCode = 1<<nBits - 1
+				if nBits == maxBits {
+					maxCode = maxMaxCode
+				}
+			}
+		}
+	}
+	if len(data) == 0 {
+		return out
+	}
+
+	table := map[[2]int]int{}
+	ent := int(data[0])
+	for _, c := range data[1:] {
+		key := [2]int{ent, int(c)}
+		if code, ok := table[key]; ok {
+			ent = code
+			continue
+		}
+		output(ent)
+		if freeEnt < maxMaxCode {
+			table[key] = freeEnt
+			freeEnt++
+		} else if blockMode {
+			clear(table)
+			freeEnt = LZW_CLEAR + 1
+			reset = true
+			output(LZW_CLEAR)
+		}
+		ent = int(c)
+	}
+	output(ent)
+	return append(out, group[:(pos+7)/8]...)
+}
+
+func TestLzwRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		for _, maxBits := range []int{9, 12, 16} {
+			for _, blockMode := range []bool{true, false} {
+				got, err := io.ReadAll(NewReader(bytes.NewReader(lzwEncode(data, maxBits, blockMode))))
+				if err != nil {
+					t.Fatalf("%s maxbits %d block mode %v: %v", name, maxBits, blockMode, err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("%s maxbits %d block mode %v: round trip mismatch", name, maxBits, blockMode)
+				}
+			}
+		}
+	}
+}
+
+func TestLzwMembers(t *testing.T) {
+	// .Z data runs to the end of the input, but may follow gzip members
+	var input, want []byte
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("member %d\n", i))
+		if i < 2 {
+			input = append(input, gzipData(t, data)...)
+		} else {
+			input = append(input, lzwEncode(data, 16, true)...)
+		}
+		want = append(want, data...)
+	}
+	got, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLzwErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"no flags", []byte{ID1, LZW_ID2}, io.ErrUnexpectedEOF},
+		{"max bits too small", []byte{ID1, LZW_ID2, LZW_BLOCK_MODE | 8, 'a', 0}, InvalidLzwData},
+		{"max bits too large", []byte{ID1, LZW_ID2, LZW_BLOCK_MODE | 17, 'a', 0}, InvalidLzwData},
+		// the first code must be a byte
+		{"first code", []byte{ID1, LZW_ID2, LZW_BLOCK_MODE | 16, 0x02, 0x01}, InvalidLzwData},
+		// 'a' followed by code 258, which is not defined yet
+		{"undefined code", []byte{ID1, LZW_ID2, LZW_BLOCK_MODE | 16, 'a', 0x04, 0x02}, InvalidLzwData},
+	} {
+		_, err := io.ReadAll(NewReader(bytes.NewReader(test.input)))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestLzwReset(t *testing.T) {
+	// the tables and output buffer of the decoder are reused across members
+	// and streams
+	data := testInputs()["text"]
+	input := append(packEncode(data), lzwEncode(data, 16, true)...)
+	want := append(bytes.Clone(data), data...)
+	d := NewReader(bytes.NewReader(input))
+	var out bytes.Buffer
+	allocs := testing.AllocsPerRun(5, func() {
+		d.Reset(bytes.NewReader(input))
+		out.Reset()
+		if _, err := io.Copy(&out, d); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Fatal("output mismatch")
+	}
+	if allocs > 10 {
+		t.Errorf("%v allocations per stream", allocs)
+	}
+
+	// without borrowing, the data handed out must survive the next chunk
+	r := NewDecompressorMultithreaded(bytes.NewReader(input))
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("multithreaded output mismatch")
+	}
+}
@@ -0,0 +1,157 @@
+package gunzip
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const PACK_MAX_BITLEN = 25
+
+// PackDecoder decodes the data of a pack (.z) file following its magic
+// bytes: the original length, a Huffman tree given by the number of leaves
+// at each depth, and the codes, read most significant bit first
+type PackDecoder struct {
+	reader  io.Reader
+	started bool
+	done    bool
+	origLen uint32
+	outLen  uint32
+	maxLen  int
+	leaves  [PACK_MAX_BITLEN + 1]int
+	parents [PACK_MAX_BITLEN + 1]int
+	litBase [PACK_MAX_BITLEN + 1]int
+	literal [256]uint8
+	out     []uint8 // returned by Next, reused by the following call
+	byteBuf [1]uint8
+	bitBuf  uint8
+	nbits   int
+}
+
+func NewPackDecoder(reader io.Reader) *PackDecoder {
+	return &PackDecoder{reader: reader, out: make([]uint8, 0, legacyChunkSize)}
+}
+
+// Reset makes the decoder decode new data from reader
+func (d *PackDecoder) Reset(reader io.Reader) {
+	d.reader = reader
+	d.started = false
+	d.done = false
+	d.outLen = 0
+	d.nbits = 0
+}
+
+// readTree reads the original length and the Huffman tree, in the manner of
+// the read_tree of GNU gzip
+func (d *PackDecoder) readTree() error {
+	var head [5]uint8
+	if _, err := io.ReadFull(d.reader, head[:]); err != nil {
+		return eofIsUnexpected(err)
+	}
+	d.origLen = binary.BigEndian.Uint32(head[:4])
+	d.maxLen = int(head[4])
+	if d.maxLen < 1 || d.maxLen > PACK_MAX_BITLEN {
+		return NewError(InvalidPackData)
+	}
+	counts := make([]uint8, d.maxLen)
+	if _, err := io.ReadFull(d.reader, counts); err != nil {
+		return eofIsUnexpected(err)
+	}
+	maxLeaves, n := 1, 0
+	for length := 1; length <= d.maxLen; length++ {
+		leaves := int(counts[length-1])
+		last := 0
+		if length == d.maxLen {
+			last = 1
+		}
+		if maxLeaves-last < leaves {
+			return NewError(InvalidPackData)
+		}
+		maxLeaves = (maxLeaves-leaves+1)*2 - 1
+		n += leaves
+		d.leaves[length] = leaves
+	}
+	if n >= 256 {
+		return NewError(InvalidPackData)
+	}
+	// the count at the maximum depth is stored minus 2 to fit in a byte;
+	// one of those is the end of block code, which has no literal
+	d.leaves[d.maxLen]++
+	if _, err := io.ReadFull(d.reader, d.literal[:n+1]); err != nil {
+		return eofIsUnexpected(err)
+	}
+	d.leaves[d.maxLen]++
+
+	// at each depth the codes below parents are inner nodes, the rest leaves
+	nodes, base := 0, 0
+	for length := 1; length <= d.maxLen; length++ {
+		d.litBase[length] = base
+		base += d.leaves[length]
+	}
+	for length := d.maxLen; length >= 1; length-- {
+		nodes >>= 1
+		d.parents[length] = nodes
+		nodes += d.leaves[length]
+	}
+	d.started = true
+	return nil
+}
+
+func (d *PackDecoder) readBit() (int, error) {
+	if d.nbits == 0 {
+		if _, err := io.ReadFull(d.reader, d.byteBuf[:]); err != nil {
+			return 0, eofIsUnexpected(err)
+		}
+		d.bitBuf = d.byteBuf[0]
+		d.nbits = 8
+	}
+	d.nbits--
+	return int(d.bitBuf>>d.nbits) & 1, nil
+}
+
+// Next returns the next chunk of decoded data, which stays valid until the
+// next call, or io.EOF after the end of block code
+func (d *PackDecoder) Next() ([]uint8, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	if !d.started {
+		if err := d.readTree(); err != nil {
+			return nil, err
+		}
+	}
+	eob := d.leaves[d.maxLen] - 1
+	out := d.out[:0]
+	code, length := 0, 0
+	for len(out) < legacyChunkSize {
+		bit, err := d.readBit()
+		if err != nil {
+			return nil, err
+		}
+		code = code<<1 | bit
+		length++
+		if code < d.parents[length] {
+			if length == d.maxLen {
+				return nil, NewError(InvalidPackData)
+			}
+			continue
+		}
+		leaf := code - d.parents[length]
+		if length == d.maxLen && leaf == eob {
+			d.done = true
+			break
+		}
+		if leaf >= d.leaves[length] {
+			return nil, NewError(InvalidPackData)
+		}
+		out = append(out, d.literal[d.litBase[length]+leaf])
+		code, length = 0, 0
+	}
+	d.outLen += uint32(len(out))
+	if d.done && d.outLen != d.origLen {
+		return nil, NewError(SizeMismatch)
+	}
+	if len(out) == 0 && d.done {
+		return nil, io.EOF
+	}
+	return out, nil
+}
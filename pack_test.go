@@ -0,0 +1,167 @@
+package gunzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+)
+
+// packEncode compresses data in the format of pack: a Huffman code whose end
+// of block code is the last one of the maximum length
+func packEncode(data []byte) []byte {
+	const eob = 256
+	type node struct {
+		freq    int
+		symbols []int
+	}
+	var nodes []node
+	freq := make([]int, 257)
+	for _, b := range data {
+		freq[b]++
+	}
+	freq[eob] = 1
+	for symbol, f := range freq {
+		if f > 0 {
+			nodes = append(nodes, node{f, []int{symbol}})
+		}
+	}
+	depth := make([]int, 257)
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].freq < nodes[j].freq })
+		merged := node{nodes[0].freq + nodes[1].freq, append(append([]int{}, nodes[0].symbols...), nodes[1].symbols...)}
+		for _, symbol := range merged.symbols {
+			depth[symbol]++
+		}
+		nodes = append([]node{merged}, nodes[2:]...)
+	}
+	maxLen := 0
+	for _, d := range depth {
+		maxLen = max(maxLen, d)
+	}
+	for symbol, d := range depth {
+		if d == maxLen && depth[eob] != maxLen {
+			depth[symbol], depth[eob] = depth[eob], maxLen
+		}
+	}
+
+	// codes are assigned as the decoder expects: at each length the inner
+	// nodes come first, then the leaves in the order of their literals
+	leaves := make([]int, maxLen+1)
+	literals := make([][]uint8, maxLen+1)
+	for symbol, d := range depth {
+		if d == 0 {
+			continue
+		}
+		leaves[d]++
+		if symbol != eob {
+			literals[d] = append(literals[d], uint8(symbol))
+		}
+	}
+	parents := make([]int, maxLen+1)
+	for length, n := maxLen, 0; length >= 1; length-- {
+		n >>= 1
+		parents[length] = n
+		n += leaves[length]
+	}
+	type code struct{ value, length int }
+	codes := make([]code, 257)
+	for length := 1; length <= maxLen; length++ {
+		for i, symbol := range literals[length] {
+			codes[symbol] = code{parents[length] + i, length}
+		}
+	}
+	codes[eob] = code{parents[maxLen] + leaves[maxLen] - 1, maxLen}
+
+	out := []byte{ID1, PACK_ID2}
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+	out = append(out, uint8(maxLen))
+	for length := 1; length <= maxLen; length++ {
+		if length == maxLen {
+			out = append(out, uint8(leaves[length]-2))
+		} else {
+			out = append(out, uint8(leaves[length]))
+		}
+	}
+	for length := 1; length <= maxLen; length++ {
+		out = append(out, literals[length]...)
+	}
+	var bits uint64
+	nbits := 0
+	put := func(symbol int) {
+		c := codes[symbol]
+		bits = bits<<c.length | uint64(c.value)
+		nbits += c.length
+		for ; nbits >= 8; nbits -= 8 {
+			out = append(out, uint8(bits>>(nbits-8)))
+		}
+	}
+	for _, b := range data {
+		put(int(b))
+	}
+	put(eob)
+	if nbits > 0 {
+		out = append(out, uint8(bits<<(8-nbits)))
+	}
+	return out
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		if len(data) == 0 {
+			// pack does not compress empty files
+			continue
+		}
+		got, err := io.ReadAll(NewReader(bytes.NewReader(packEncode(data))))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestPackMembers(t *testing.T) {
+	// unlike .Z data, pack data ends with a code and can be followed by
+	// other members
+	parts := [][]byte{[]byte("first\n"), []byte("second\n"), []byte("third\n")}
+	input := append(packEncode(parts[0]), gzipData(t, parts[1])...)
+	input = append(input, packEncode(parts[2])...)
+	got, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(parts, nil); !bytes.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestPackErrors(t *testing.T) {
+	valid := packEncode([]byte("pack data"))
+	sizeMismatch := bytes.Clone(valid)
+	sizeMismatch[5]++
+	manyLeaves := bytes.Clone(valid)
+	manyLeaves[7] = 0xff
+	for _, test := range []struct {
+		name  string
+		input []byte
+		want  error
+	}{
+		{"truncated length", valid[:5], io.ErrUnexpectedEOF},
+		{"truncated tree", valid[:9], io.ErrUnexpectedEOF},
+		{"truncated data", valid[:len(valid)-1], io.ErrUnexpectedEOF},
+		{"no code lengths", append(bytes.Clone(valid[:6]), 0), InvalidPackData},
+		{"code too long", append(bytes.Clone(valid[:6]), PACK_MAX_BITLEN+1), InvalidPackData},
+		{"too many leaves", manyLeaves, InvalidPackData},
+		{"size", sizeMismatch, SizeMismatch},
+		{"garbage after member", append(bytes.Clone(valid), 1, 2, 3), TrailingGarbage},
+	} {
+		_, err := io.ReadAll(NewReader(bytes.NewReader(test.input)))
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+	}
+}
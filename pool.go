@@ -0,0 +1,33 @@
+package gunzip
+
+import (
+	"io"
+	"sync"
+)
+
+// decompressors holds gzip Decompressors returned by PutReader
+var decompressors sync.Pool
+
+// GetReader returns a Decompressor that reads gzip data from reader, reusing
+// one returned by PutReader if available. It saves the buffers, window and
+// tables that NewReader allocates, which dominate the cost of decoding small
+// payloads.
+func GetReader(reader io.Reader) *Decompressor {
+	if d, ok := decompressors.Get().(*Decompressor); ok {
+		d.Reset(reader)
+		return d
+	}
+	return NewReader(reader)
+}
+
+// PutReader returns d to the pool used by GetReader. d must not be used
+// afterwards. Its reader and limits are dropped; decompressors of other
+// formats than gzip are not pooled.
+func PutReader(d *Decompressor) {
+	if d == nil || d.container != (GzipContainer{}) || d.producer.format != DeflateFormat {
+		return
+	}
+	d.Reset(nil)
+	d.SetLimits(Limits{})
+	decompressors.Put(d)
+}
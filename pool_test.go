@@ -0,0 +1,63 @@
+package gunzip
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// raceEnabled is set when testing with the race detector, which allocates
+// and drops pooled objects
+var raceEnabled bool
+
+func TestReuseAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not representative with the race detector")
+	}
+	// reusing a Decompressor keeps its window, tables and legacy decoders;
+	// what is left is the header and footer of each member and the input
+	data := testInputs()["text"]
+	inputs := map[string][]byte{
+		"gzip":     gzipData(t, data),
+		"small":    gzipData(t, data[:100]),
+		"compress": lzwEncode(data, 16, true),
+		"pack":     packEncode(data),
+	}
+	const maxAllocs = 6
+	for name, input := range inputs {
+		want, _ := io.ReadAll(NewReader(bytes.NewReader(input)))
+		var out bytes.Buffer
+		out.Grow(len(want))
+
+		d := NewReader(bytes.NewReader(input))
+		allocs := testing.AllocsPerRun(10, func() {
+			out.Reset()
+			d.Reset(bytes.NewReader(input))
+			if _, err := io.Copy(&out, d); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Fatalf("%s: Reset output mismatch", name)
+		}
+		if allocs > maxAllocs {
+			t.Errorf("%s: %v allocations per stream with Reset", name, allocs)
+		}
+
+		PutReader(GetReader(nil))
+		allocs = testing.AllocsPerRun(10, func() {
+			out.Reset()
+			r := GetReader(bytes.NewReader(input))
+			if _, err := io.Copy(&out, r); err != nil {
+				t.Fatal(err)
+			}
+			PutReader(r)
+		})
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Fatalf("%s: GetReader output mismatch", name)
+		}
+		if allocs > maxAllocs {
+			t.Errorf("%s: %v allocations per stream with GetReader", name, allocs)
+		}
+	}
+}
@@ -1,4 +1,9 @@
-package main
+package gunzip
+
+import (
+	"fmt"
+	"io"
+)
 
 type State int
 
@@ -8,6 +13,7 @@ const (
 	StateInflate
 	StateInflateFinalBlock
 	StateFooter
+	StateLegacy
 )
 
 type ProduceTag int
@@ -27,22 +33,259 @@ type Produce struct {
 
 type Producer struct {
 	reader      BitRead
+	container   Container
+	format      *Format
 	state       State
 	memberIdx   int
 	window      SlidingWindow
-	llDecoder   *HuffmanDecoder
-	distDecoder *HuffmanDecoder
+	llDecoder   *HuffmanDecoder // the fixed code or llDynamic
+	distDecoder *HuffmanDecoder // the fixed code or distDynamic
+	llDynamic   HuffmanDecoder
+	distDynamic HuffmanDecoder
+	tables      dynamicTables
+	legacy      legacyDecoder // lzw or pack while decoding such a member
+	lzw         *LzwDecoder
+	pack        *PackDecoder
+	limits      Limits
+	borrow      bool      // return decoded data in place in the window
+	slide       int       // bytes to slide the window by before decoding more
+	produce     Produce   // returned by Next when borrowing
+	out         int64     // bytes produced so far
+	memberOut   int64     // bytes produced in the current member
+	block       int       // index of the current block within the member
+	blockType   BlockType // type of the current block
+}
+
+// Limits bound what a Producer decodes, as a defense against decompression
+// bombs. Zero fields are not enforced.
+//
+// MaxRatio compares the output with the input consumed so far rather than
+// with the size of the whole input, which is not known while reading. It is
+// only enforced once the output exceeds RatioMinOutput, so that small but
+// highly compressible streams are not rejected.
+type Limits struct {
+	MaxOutput       int64   // total uncompressed size
+	MaxMemberOutput int64   // uncompressed size of each member
+	MaxMembers      int     // number of members
+	MaxRatio        float64 // uncompressed size per byte of input consumed so far
+}
+
+// RatioMinOutput is the output below which Limits.MaxRatio is not enforced
+const RatioMinOutput = 1 << 20
+
+// legacyDecoder decodes the formats that predate gzip but share its magic
+// byte, which gunzip accepts as members
+type legacyDecoder interface {
+	Next() ([]uint8, error)
 }
 
 func NewProducer(reader BitRead) *Producer {
-	return &Producer{reader, StateHeader, 0, *NewSlidingWindow(), EmptyHuffmanDecoder(), EmptyHuffmanDecoder()}
+	return NewProducerContainer(reader, GzipContainer{})
+}
+
+// NewProducerContainer returns a Producer for DEFLATE data framed as
+// described by container
+func NewProducerContainer(reader BitRead, container Container) *Producer {
+	return NewProducerFormat(reader, container, DeflateFormat)
+}
+
+// NewProducerFormat returns a Producer for data in the given format, such as
+// Deflate64Format
+func NewProducerFormat(reader BitRead, container Container, format *Format) *Producer {
+	return &Producer{
+		reader:      reader,
+		container:   container,
+		format:      format,
+		state:       StateHeader,
+		window:      *NewSlidingWindowSize(format.MaxDistance),
+		llDecoder:   EmptyHuffmanDecoder(),
+		distDecoder: EmptyHuffmanDecoder(),
+	}
+}
+
+// Reset makes the producer decode a new stream from reader, keeping its
+// window, tables and limits
+func (p *Producer) Reset(reader BitRead) {
+	p.reader = reader
+	p.state = StateHeader
+	p.memberIdx = 0
+	p.window.Reset()
+	p.legacy = nil
+	p.slide = 0
+	p.out = 0
+	p.memberOut = 0
+	p.block = 0
+	p.blockType = 0
+	p.llDecoder = emptyDecoder
+	p.distDecoder = emptyDecoder
+	p.produce = Produce{}
+}
+
+// startLegacy returns the decoder for a member in the legacy format given
+// by the second magic byte, reusing the one of a previous member
+func (p *Producer) startLegacy(id2 uint8) legacyDecoder {
+	if id2 == LZW_ID2 {
+		if p.lzw == nil {
+			p.lzw = NewLzwDecoder(p.reader)
+		} else {
+			p.lzw.Reset(p.reader)
+		}
+		return p.lzw
+	}
+	if p.pack == nil {
+		p.pack = NewPackDecoder(p.reader)
+	} else {
+		p.pack.Reset(p.reader)
+	}
+	return p.pack
+}
+
+// emit returns a produce, which is reused when borrowing
+func (p *Producer) emit(tag ProduceTag, head *Header, foot *Footer, data []uint8) *Produce {
+	if p.borrow {
+		p.produce = Produce{tag, head, foot, data}
+		return &p.produce
+	}
+	return &Produce{tag, head, foot, data}
+}
+
+// ResumeProducer returns a Producer that continues decoding from a boundary
+// reached by another Producer, given that producer's state and history
+func ResumeProducer(reader BitRead, state State, history []uint8) *Producer {
+	p := NewProducer(reader)
+	p.state = state
+	p.memberIdx = 1
+	p.setHistory(history)
+	return p
+}
+
+// setHistory primes the window with the last bytes of history that are
+// within reach
+func (p *Producer) setHistory(history []uint8) {
+	history = history[max(0, len(history)-p.format.MaxDistance):]
+	copy(p.window.Data, history)
+	p.window.Boundary = len(history)
+}
+
+// SetLimits sets the limits enforced from now on
+func (p *Producer) SetLimits(limits Limits) {
+	p.limits = limits
+}
+
+// checkLimits fails if producing n more bytes would exceed the limits
+func (p *Producer) checkLimits(n int) error {
+	out := p.out + int64(n)
+	if p.limits.MaxOutput > 0 && out > p.limits.MaxOutput {
+		return &Error{Kind: LimitExceeded, Err: fmt.Errorf("output larger than %d bytes", p.limits.MaxOutput)}
+	}
+	if p.limits.MaxMemberOutput > 0 && p.memberOut+int64(n) > p.limits.MaxMemberOutput {
+		return &Error{Kind: LimitExceeded, Err: fmt.Errorf("member larger than %d bytes", p.limits.MaxMemberOutput)}
+	}
+	if p.limits.MaxRatio > 0 && out > RatioMinOutput && float64(out) > p.limits.MaxRatio*float64(max(p.reader.BitOffset()/8, 1)) {
+		return &Error{Kind: LimitExceeded, Err: fmt.Errorf("expansion ratio above %g", p.limits.MaxRatio)}
+	}
+	p.memberOut += int64(n)
+	return nil
+}
+
+// State returns the state the next call to Next starts from
+func (p *Producer) State() State {
+	return p.state
+}
+
+// AtBoundary reports whether the producer is between blocks or members, the
+// points from which ResumeProducer can continue
+func (p *Producer) AtBoundary() bool {
+	return p.state == StateBlock || p.state == StateHeader
+}
+
+// History returns the bytes produced in the current member that are still
+// within reach, the last MAX_DISTANCE for deflate
+func (p *Producer) History() []uint8 {
+	p.slideWindow()
+	return p.window.History()
+}
+
+// slideWindow moves past the data last returned in place, which is then
+// overwritten
+func (p *Producer) slideWindow() {
+	if p.slide > 0 {
+		p.window.Slide(p.slide)
+		p.slide = 0
+	}
 }
 
 // returns nil as producer if done
 func (p *Producer) Next() (*Produce, error) {
+	p.slideWindow()
+	produce, err := p.next()
+	if err == io.EOF {
+		// running out of input anywhere but between members is a truncation
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return produce, p.annotate(err)
+	}
+	if produce != nil && produce.Tag == ProduceData {
+		p.out += int64(len(produce.Data))
+	}
+	return produce, nil
+}
+
+// annotate records where decoding stopped in err, wrapping errors that do not
+// come from this package
+func (p *Producer) annotate(err error) error {
+	e, ok := err.(*Error)
+	if !ok {
+		e = NewIoError(err)
+	}
+	if e.Member != 0 {
+		return e
+	}
+	e.Member = p.memberIdx
+	e.BitOffset = p.reader.BitOffset()
+	e.Offset = p.out
+	e.Block = p.block
+	e.BlockType = p.blockType
+	return e
+}
+
+// memberFollows reports whether the data following a member starts another
+// one. Like gzip, zero padding after the last member is consumed and ignored,
+// while any other data is reported as TrailingGarbage.
+func memberFollows(reader BitRead) (bool, error) {
+	bits, err := reader.PeekBits()
+	if err != nil {
+		return false, err
+	}
+	if id2 := uint8(bits >> 8); uint8(bits) == ID1 && (id2 == ID2 || id2 == LZW_ID2 || id2 == PACK_ID2) {
+		return true, nil
+	}
+	garbage := &Error{Kind: TrailingGarbage, BitOffset: reader.BitOffset()}
+	var buf [512]uint8
+	for {
+		n, err := reader.Read(buf[:])
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, garbage
+			}
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+func (p *Producer) next() (*Produce, error) {
 	if p.state == StateHeader {
+		if p.memberIdx > 0 && !p.container.Multimember() {
+			return nil, nil
+		}
 		dataLeft, err := p.reader.HasDataLeft()
-		if err != nil {
+		if err != nil && err != io.EOF {
 			return nil, err
 		}
 		if !dataLeft {
@@ -52,16 +295,37 @@ func (p *Producer) Next() (*Produce, error) {
 				return nil, nil
 			}
 		}
+		if p.memberIdx > 0 {
+			if member, err := memberFollows(p.reader); !member {
+				if e, ok := err.(*Error); ok {
+					e.Member, e.Offset = p.memberIdx, p.out
+				}
+				return nil, err
+			}
+		}
 		p.state = StateBlock
 		p.memberIdx += 1
-		header, err := ReadHeader(p.reader)
-		return &Produce{ProduceHeader, header, nil, nil}, err
+		if p.limits.MaxMembers > 0 && p.memberIdx > p.limits.MaxMembers {
+			return nil, &Error{Kind: LimitExceeded, Err: fmt.Errorf("more than %d members", p.limits.MaxMembers)}
+		}
+		p.block = 0
+		p.blockType = 0
+		p.memberOut = 0
+		header, dict, err := p.container.ReadHeader(p.reader)
+		if err == nil && header != nil && header.IsLegacy() {
+			p.legacy = p.startLegacy(header.Header[1])
+			p.state = StateLegacy
+		}
+		p.setHistory(dict)
+		return p.emit(ProduceHeader, header, nil, nil), err
 	} else if p.state == StateBlock {
 		header, err := p.reader.ReadBits(3)
 		if err != nil {
 			return nil, err
 		}
 		is_final := (header & 1) == 1
+		p.block += 1
+		p.blockType = BlockType(header >> 1)
 
 		if header&0b110 == 0b000 {
 			if is_final {
@@ -69,8 +333,13 @@ func (p *Producer) Next() (*Produce, error) {
 			}
 			return p.inflateBlock0()
 		} else if header&0b110 == 0b010 {
-			p.llDecoder = NewHuffmanDecoder(NewDefaultLLCodebook())
-			p.distDecoder = NewHuffmanDecoder(NewDefaultDistCodebook())
+			p.llDecoder = fixedLLDecoder
+			p.distDecoder = fixedDistDecoder
+			if is_final {
+				p.state = StateInflateFinalBlock
+			} else {
+				p.state = StateInflate
+			}
 			return p.inflate(is_final)
 		} else if header&0b110 == 0b100 {
 			p.llDecoder, p.distDecoder, err = p.readDynamicCodebooks()
@@ -90,11 +359,27 @@ func (p *Producer) Next() (*Produce, error) {
 		return p.inflate(false)
 	} else if p.state == StateInflateFinalBlock {
 		return p.inflate(true)
+	} else if p.state == StateLegacy {
+		data, err := p.legacy.Next()
+		if err == io.EOF {
+			p.state = StateHeader
+			p.legacy = nil
+			return p.next()
+		}
+		if err == nil {
+			err = p.checkLimits(len(data))
+		}
+		if !p.borrow {
+			// the legacy decoders reuse their output buffer
+			data = append([]uint8(nil), data...)
+		}
+		return p.emit(ProduceData, nil, nil, data), err
 	} else if p.state == StateFooter {
 		p.state = StateHeader
-		p.window = *NewSlidingWindow() // reset history
-		footer, err := ReadFooter(p.reader)
-		return &Produce{ProduceFooter, nil, footer, nil}, err
+		p.block = 0
+		p.window.Reset() // forget the history
+		footer, err := p.container.ReadFooter(p.reader)
+		return p.emit(ProduceFooter, nil, footer, nil), err
 	}
 	panic("unreachable")
 }
@@ -112,24 +397,39 @@ func (p *Producer) inflateBlock0() (*Produce, error) {
 	if length^nlength != 0xFFFF {
 		return nil, NewError(BlockType0LenMismatch)
 	}
+	if err := p.checkLimits(int(length)); err != nil {
+		return nil, err
+	}
+	if p.borrow {
+		// the window has room for the largest stored block
+		buf := p.window.WriteBuffer()[:length]
+		if err := p.reader.ReadExact(buf); err != nil {
+			return nil, err
+		}
+		p.slide = int(length)
+		return p.emit(ProduceData, nil, nil, buf), nil
+	}
 	buf := make([]uint8, int(length))
 	err = p.reader.ReadExact(buf)
 	if err != nil {
 		return nil, err
 	}
-	n := min(length, MAX_DISTANCE)
-	copy(p.window.WriteBuffer()[:n], buf[length-n:length])
-	p.window.Slide((int(n)))
-	return &Produce{ProduceData, nil, nil, buf}, nil
+	n := min(int(length), p.format.MaxDistance)
+	copy(p.window.WriteBuffer()[:n], buf[int(length)-n:])
+	p.window.Slide(n)
+	return p.emit(ProduceData, nil, nil, buf), nil
 }
 
 func (p *Producer) inflate(is_final bool) (*Produce, error) {
 	boundary := p.window.Boundary
-	result, err := Decode(p.window.Data, boundary, p.reader, p.llDecoder, p.distDecoder)
+	result, err := DecodeFormat(p.format, p.window.Data, boundary, p.reader, p.llDecoder, p.distDecoder)
 	if err != nil {
 		return nil, err
 	}
 	n := int(result.N)
+	if err := p.checkLimits(n); err != nil {
+		return nil, err
+	}
 	if result.Tag == Done {
 		if is_final {
 			p.state = StateFooter
@@ -138,52 +438,86 @@ func (p *Producer) inflate(is_final bool) (*Produce, error) {
 		}
 	}
 
+	if p.borrow {
+		// the data stays valid until the next call to Next
+		p.slide = n
+		return p.emit(ProduceData, nil, nil, p.window.WriteBuffer()[:n]), nil
+	}
 	buf := make([]uint8, n)
 	copy(buf, p.window.WriteBuffer()[:n])
 	p.window.Slide(n)
-	return &Produce{ProduceData, nil, nil, buf}, nil
+	return p.emit(ProduceData, nil, nil, buf), nil
 }
 
 func (p *Producer) readDynamicCodebooks() (*HuffmanDecoder, *HuffmanDecoder, error) {
-	hlit, err := p.reader.ReadBits(5)
+	llCodes, distCodes, err := p.tables.read(p.reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.llDynamic.build(llCodes)
+	p.distDynamic.build(distCodes)
+	return &p.llDynamic, &p.distDynamic, nil
+}
+
+// ReadDynamicCodebooks reads the code lengths at the start of a dynamic block
+// and returns the literal/length and distance codebooks
+func ReadDynamicCodebooks(reader BitRead) (*Codebook, *Codebook, error) {
+	var t dynamicTables
+	return t.read(reader)
+}
+
+// dynamicTables holds the code lengths and codebooks of a dynamic block
+// header, reused from block to block
+type dynamicTables struct {
+	clLengths [19]uint32
+	lengths   []uint32
+	cl        Codebook
+	clDecoder HuffmanDecoder
+	ll        Codebook
+	dist      Codebook
+}
+
+func (t *dynamicTables) read(reader BitRead) (*Codebook, *Codebook, error) {
+	hlit, err := reader.ReadBits(5)
 	if err != nil {
 		return nil, nil, err
 	}
 	hlit += 257
 
-	hdist, err := p.reader.ReadBits(5)
+	hdist, err := reader.ReadBits(5)
 	if err != nil {
 		return nil, nil, err
 	}
 	hdist += 1
 
-	hclen, err := p.reader.ReadBits(4)
+	hclen, err := reader.ReadBits(4)
 	if err != nil {
 		return nil, nil, err
 	}
 	hclen += 4
 
-	clLengths := make([]uint32, 19)
+	clLengths := t.clLengths[:]
+	clear(clLengths)
 	for i, idx := range []int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15} {
 		if i >= int(hclen) {
 			break
 		}
-		length, err := p.reader.ReadBits(3)
+		length, err := reader.ReadBits(3)
 		if err != nil {
 			return nil, nil, err
 		}
 		clLengths[idx] = length
 	}
-	clCodebook, err := NewCodebook(clLengths)
-	if err != nil {
+	if err := t.cl.build(clLengths); err != nil {
 		return nil, nil, err
 	}
-	clDecoder := NewHuffmanDecoder(clCodebook)
+	clDecoder := &t.clDecoder
+	clDecoder.build(&t.cl)
 
 	numCodes := int(hlit + hdist)
-	lengths := make([]uint32, 0)
+	lengths := t.lengths[:0]
 	for len(lengths) < numCodes {
-		bits, err := p.reader.PeekBits()
+		bits, err := reader.PeekBits()
 		if err != nil {
 			return nil, nil, err
 		}
@@ -191,11 +525,14 @@ func (p *Producer) readDynamicCodebooks() (*HuffmanDecoder, *HuffmanDecoder, err
 		if err != nil {
 			return nil, nil, err
 		}
-		p.reader.Consume(int(pair.Length))
+		reader.Consume(int(pair.Length))
 		if pair.Symbol <= 15 {
 			lengths = append(lengths, pair.Symbol)
 		} else if pair.Symbol == 16 {
-			length, err := p.reader.ReadBits(2)
+			if len(lengths) == 0 {
+				return nil, nil, NewError(ReadDynamicCodebook)
+			}
+			length, err := reader.ReadBits(2)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -205,7 +542,7 @@ func (p *Producer) readDynamicCodebooks() (*HuffmanDecoder, *HuffmanDecoder, err
 				lengths = append(lengths, x)
 			}
 		} else if pair.Symbol == 17 {
-			length, err := p.reader.ReadBits(3)
+			length, err := reader.ReadBits(3)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -214,7 +551,7 @@ func (p *Producer) readDynamicCodebooks() (*HuffmanDecoder, *HuffmanDecoder, err
 				lengths = append(lengths, 0)
 			}
 		} else if pair.Symbol == 18 {
-			length, err := p.reader.ReadBits(7)
+			length, err := reader.ReadBits(7)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -227,17 +564,16 @@ func (p *Producer) readDynamicCodebooks() (*HuffmanDecoder, *HuffmanDecoder, err
 		}
 	}
 
+	t.lengths = lengths
 	if len(lengths) != numCodes {
 		return nil, nil, NewError(ReadDynamicCodebook)
 	}
 
-	llCodes, err := NewCodebook(lengths[:hlit])
-	if err != nil {
+	if err := t.ll.build(lengths[:hlit]); err != nil {
 		return nil, nil, err
 	}
-	distCodes, err := NewCodebook(lengths[hlit:])
-	if err != nil {
+	if err := t.dist.build(lengths[hlit:]); err != nil {
 		return nil, nil, err
 	}
-	return NewHuffmanDecoder(llCodes), NewHuffmanDecoder(distCodes), nil
+	return &t.ll, &t.dist, nil
 }
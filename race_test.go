@@ -0,0 +1,7 @@
+//go:build race
+
+package gunzip
+
+func init() {
+	raceEnabled = true
+}
@@ -0,0 +1,331 @@
+package gunzip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Skip describes a damaged range of the input that SalvageReader could not
+// decode
+type Skip struct {
+	From   int64 // bit offset of the block or member in which decoding failed
+	To     int64 // bit offset at which decoding resumed, the input size if never
+	Offset int64 // offset in the output at which data is missing
+	Err    error // the error that was detected
+}
+
+func (s Skip) String() string {
+	if s.From == s.To {
+		return fmt.Sprintf("%v; continuing at bit offset %d", s.Err, s.To)
+	}
+	return fmt.Sprintf("%v; skipped bits %d to %d, output offset %d", s.Err, s.From, s.To, s.Offset)
+}
+
+// SalvageReader decodes as much as possible of a damaged gzip file. When a
+// member fails to decode, the data decoded so far is kept and the input after
+// the last good block boundary is searched for the next gzip member header or
+// non-final dynamic block that decodes to its end, from which decoding
+// resumes. A checksum or length mismatch is recorded and decoding continues
+// with the next member. Every such event is appended to Skips.
+//
+// Data resumed within a member may refer back to data lost in the damaged
+// range. Such bytes are output as '?' and recorded in Skips as an error of
+// kind MissingHistory; the footer of that member is not verified.
+type SalvageReader struct {
+	input io.ReaderAt
+	size  int64
+	Skips []Skip
+
+	producer *Producer // nil once nothing more can be decoded
+	reader   *BitReader
+	resumed  bool       // producer did not start at the beginning
+	base     int64      // bit offset at which reader starts
+	start    int64      // output offset at which producer started
+	boundary int64      // bit offset of the last block or member boundary
+	pending  []*Produce // decoded while looking for a place to resume
+	retry    error      // salvage from boundary once pending is returned
+	damaged  bool       // the current member has been skipped into
+	out      int64
+
+	buf      []uint8
+	begin    int
+	checksum Checksum
+}
+
+// NewSalvageReader returns a reader over the gzip file of the given size in
+// input that skips over damaged data
+func NewSalvageReader(input io.ReaderAt, size int64) *SalvageReader {
+	reader := NewBitReader(io.NewSectionReader(input, 0, size))
+	return &SalvageReader{
+		input:    input,
+		size:     size,
+		producer: NewProducer(reader),
+		reader:   reader,
+		checksum: NewCrc32(),
+	}
+}
+
+// salvageable reports whether decoding may resume after err: it is raised on
+// corrupt data, rather than by the underlying reader, on empty input or after
+// the last member
+func salvageable(err error) bool {
+	var e *Error
+	if !errors.As(err, &e) || e.Kind == EmptyInput || e.Kind == TrailingGarbage {
+		return false
+	}
+	return e.Kind != StdIoError || errors.Is(e.Err, io.ErrUnexpectedEOF)
+}
+
+func (r *SalvageReader) next() (*Produce, error) {
+	for {
+		if len(r.pending) > 0 {
+			produce := r.pending[0]
+			r.pending = r.pending[1:]
+			return produce, nil
+		}
+		if r.retry != nil {
+			err := r.retry
+			r.retry = nil
+			r.salvage(err)
+			continue
+		}
+		if r.producer == nil {
+			return nil, nil
+		}
+		produce, err := r.producer.Next()
+		if err == nil {
+			if r.producer.AtBoundary() {
+				r.boundary = r.base + r.reader.BitOffset()
+			}
+			return produce, nil
+		}
+		if r.resumed {
+			err = rebase(err, r.base, r.start)
+		}
+		if !salvageable(err) {
+			return nil, err
+		}
+		r.salvage(err)
+	}
+}
+
+// salvage looks for a place to resume decoding after err
+func (r *SalvageReader) salvage(err error) {
+	skip := Skip{From: r.boundary, To: r.size * 8, Offset: r.out, Err: err}
+	r.producer = nil
+	r.damaged = true
+
+	scanner := NewBitReader(nil)
+	buf := make([]uint8, scanBlockSize+maxDynamicHeader+16)
+	for first := (r.boundary + 1) / 8; first < r.size; first += scanBlockSize {
+		// the block plus room for the longest dynamic block header, padded
+		// so that isBlockCandidate can always read ahead
+		n, _ := r.input.ReadAt(buf[:len(buf)-16], first)
+		clear(buf[n:])
+		end := min(first+scanBlockSize, r.size) * 8
+		for bit := max(r.boundary+1, first*8); bit < end; bit++ {
+			offset := bit - first*8
+			if offset%8 == 0 && bytes.HasPrefix(buf[offset/8:n], []uint8{ID1, ID2, DEFLATE}) && r.resumeMember(bit) {
+				skip.To = bit
+				r.Skips = append(r.Skips, skip)
+				return
+			}
+			if isBlockCandidate(buf, offset) && isDynamicBlock(scanner, buf, offset) && r.resumeBlock(bit) {
+				skip.To = bit
+				r.Skips = append(r.Skips, skip)
+				return
+			}
+		}
+	}
+	r.Skips = append(r.Skips, skip)
+}
+
+// resumeMember decodes the member starting at bit offset bit to the end of
+// its first block. If that succeeds decoding continues from there, and the
+// data is kept to be returned.
+func (r *SalvageReader) resumeMember(bit int64) bool {
+	reader := r.readerAt(bit)
+	producer := ResumeProducer(reader, StateHeader, nil)
+	var pending []*Produce
+	for {
+		produce, err := producer.Next()
+		if err != nil {
+			return false
+		}
+		if produce == nil {
+			break
+		}
+		pending = append(pending, produce)
+		if producer.block > 0 && (producer.state == StateBlock || producer.state == StateFooter) {
+			break
+		}
+	}
+	r.continueWith(producer, reader, bit, r.out)
+	r.pending = pending
+	return true
+}
+
+// resumeBlock decodes from the block at bit offset bit, within a member whose
+// preceding data is lost. Back-references into that data decode to markers,
+// as in ChunkDecoder, until the last MAX_DISTANCE bytes are all known and a
+// Producer can take over; markers are output as '?'. It fails if the first
+// block does not decode.
+func (r *SalvageReader) resumeBlock(bit int64) bool {
+	c := NewChunkDecoder(r.input, r.size, bit, nil)
+	var pending []*Produce
+	missing, firstMissing := 0, int64(-1)
+	out := r.out
+	// emit resolves the symbols decoded up to end into pending
+	emit := func(end int) {
+		data := make([]uint8, end-MAX_DISTANCE)
+		for i, symbol := range c.out[MAX_DISTANCE:end] {
+			if symbol >= MarkerBase {
+				if firstMissing < 0 {
+					firstMissing = out + int64(i)
+				}
+				symbol = '?'
+				missing++
+			}
+			data[i] = uint8(symbol)
+		}
+		if len(data) > 0 {
+			pending = append(pending, &Produce{Tag: ProduceData, Data: data})
+		}
+		out += int64(len(data))
+	}
+
+	blocks, state := 0, StateBlock
+	good, goodBit := len(c.out), bit
+	lastMarker, scanned := MAX_DISTANCE-1, MAX_DISTANCE
+	var err error
+	for {
+		var final bool
+		if final, err = c.decodeBlock(); err != nil {
+			break
+		}
+		blocks++
+		good, goodBit = len(c.out), c.BitOffset()
+		if final {
+			state = StateFooter
+			break
+		}
+		for ; scanned < len(c.out); scanned++ {
+			if c.out[scanned] >= MarkerBase {
+				lastMarker = scanned
+			}
+		}
+		if len(c.out)-lastMarker > MAX_DISTANCE {
+			break
+		}
+		if len(c.out) >= 4*MAX_DISTANCE {
+			// keep only the window, markers included
+			emit(len(c.out))
+			shift := len(c.out) - MAX_DISTANCE
+			c.out = append(c.out[:0], c.out[shift:]...)
+			lastMarker, scanned = lastMarker-shift, scanned-shift
+			good = len(c.out)
+		}
+	}
+	if blocks == 0 {
+		return false
+	}
+	emit(good)
+	if missing > 0 {
+		r.Skips = append(r.Skips, Skip{From: bit, To: bit, Offset: firstMissing, Err: &Error{
+			Kind: MissingHistory, BitOffset: bit, Offset: firstMissing, Err: fmt.Errorf("%d bytes output as '?'", missing),
+		}})
+	}
+
+	if err != nil {
+		// a later block is damaged too: salvage again from the last good one
+		r.producer = nil
+		r.boundary = goodBit
+		r.retry = &Error{Kind: StdIoError, Err: eofIsUnexpected(err), BitOffset: goodBit, Offset: out}
+		if e, ok := err.(*Error); ok {
+			r.retry = &Error{Kind: e.Kind, Err: e.Err, BitOffset: goodBit, Offset: out}
+		}
+	} else {
+		history := make([]uint8, 0, MAX_DISTANCE)
+		if state == StateBlock {
+			for _, symbol := range c.out[good-MAX_DISTANCE : good] {
+				history = append(history, uint8(symbol))
+			}
+		}
+		reader := r.readerAt(goodBit)
+		r.continueWith(ResumeProducer(reader, state, history), reader, goodBit, out)
+	}
+	r.pending = pending
+	return true
+}
+
+// readerAt returns a BitReader positioned at bit offset bit of the input
+func (r *SalvageReader) readerAt(bit int64) *BitReader {
+	reader := NewBitReader(io.NewSectionReader(r.input, bit/8, r.size-bit/8))
+	reader.Consume(int(bit % 8))
+	return reader
+}
+
+// continueWith makes producer, reading from bit offset bit with reader, the
+// source of the data following output offset out
+func (r *SalvageReader) continueWith(producer *Producer, reader *BitReader, bit int64, out int64) {
+	r.producer = producer
+	r.reader = reader
+	r.resumed = true
+	r.base = bit - bit%8
+	r.start = out
+	r.boundary = r.base + reader.BitOffset()
+}
+
+func (r *SalvageReader) fillBuffer() (int, error) {
+	for {
+		produce, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		if produce == nil {
+			return 0, io.EOF
+		}
+		if produce.Tag == ProduceHeader {
+			r.checksum.Reset()
+			r.damaged = false
+		} else if produce.Tag == ProduceFooter {
+			if r.damaged {
+				continue // the mismatch is already accounted for
+			}
+			if err := produce.Foot.Verify(r.checksum); err != nil {
+				err = r.producer.annotate(err)
+				if r.resumed {
+					err = rebase(err, r.base, r.start)
+				}
+				r.Skips = append(r.Skips, Skip{From: r.boundary, To: r.boundary, Offset: r.out, Err: err})
+			}
+		} else if produce.Tag == ProduceData {
+			xs := produce.Data
+			if len(xs) == 0 {
+				continue
+			}
+			r.checksum.Update(xs)
+			r.out += int64(len(xs))
+			r.buf = xs
+			r.begin = 0
+			return len(xs), nil
+		}
+	}
+}
+
+func (r *SalvageReader) Read(buf []uint8) (int, error) {
+	nbytes := 0
+	for nbytes < len(buf) {
+		if r.begin == len(r.buf) {
+			if _, err := r.fillBuffer(); err != nil {
+				return nbytes, err
+			}
+		}
+		n := copy(buf[nbytes:], r.buf[r.begin:])
+		nbytes += n
+		r.begin += n
+	}
+	return nbytes, nil
+}
@@ -0,0 +1,140 @@
+package gunzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// salvage decodes input with a SalvageReader
+func salvage(t *testing.T, input []byte) ([]byte, []Skip) {
+	t.Helper()
+	r := NewSalvageReader(bytes.NewReader(input), int64(len(input)))
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("salvage: %v", err)
+	}
+	return got, r.Skips
+}
+
+// matchesSuffix reports whether got is the end of want, where '?' in got
+// stands for any byte
+func matchesSuffix(got, want []byte) bool {
+	if len(got) > len(want) {
+		return false
+	}
+	want = want[len(want)-len(got):]
+	for i := range got {
+		if got[i] != '?' && got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSalvageResumesWithinMember(t *testing.T) {
+	// the text has no '?', and refers back a lot
+	data := testInputs()["text"]
+	for _, level := range []int{1, 6} {
+		input := gzipLevel(t, data, level)
+		index, err := BuildIndex(bytes.NewReader(input), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a reserved block type in the header of a block followed by
+		// others, so that all the data before that block is intact
+		var damaged Checkpoint
+		for _, c := range index.Checkpoints {
+			if c.State == StateBlock && c.Out < int64(len(data)*3/4) {
+				damaged = c
+				break
+			}
+		}
+		corrupt := bytes.Clone(input)
+		for bit := damaged.In + 1; bit < damaged.In+3; bit++ {
+			corrupt[bit/8] |= 1 << (bit % 8)
+		}
+		intact := damaged.Out
+
+		got, skips := salvage(t, corrupt)
+		if len(skips) == 0 {
+			t.Fatalf("level %d: no skip recorded", level)
+		}
+		lost := skips[0].Offset
+		if lost < intact || !bytes.Equal(got[:intact], data[:intact]) {
+			t.Fatalf("level %d: data before the damage differs", level)
+		}
+		if !matchesSuffix(got[lost:], data) {
+			t.Fatalf("level %d: resumed data is not the end of the input", level)
+		}
+		if len(got)-int(lost) < len(data)/8 {
+			t.Errorf("level %d: resumed only %d bytes", level, len(got)-int(lost))
+		}
+		missing := false
+		for _, skip := range skips {
+			missing = missing || errors.Is(skip.Err, MissingHistory)
+		}
+		if !missing || !bytes.Contains(got, []byte("?")) {
+			t.Errorf("level %d: no reference into the damaged block reported: %v", level, skips)
+		}
+	}
+}
+
+func TestSalvageMembers(t *testing.T) {
+	first, second := []byte("first member\n"), testInputs()["text"]
+	corrupt := gzipData(t, first)
+	corrupt[12] ^= 0xff // in the data of the first member
+	input := append(corrupt, gzipData(t, second)...)
+
+	got, skips := salvage(t, input)
+	if len(skips) != 1 || !bytes.HasSuffix(got, second) {
+		t.Fatalf("got %d bytes and skips %v", len(got), skips)
+	}
+}
+
+func TestSalvageChecksum(t *testing.T) {
+	data := []byte("intact data with a bad checksum")
+	input := gzipData(t, data)
+	input[len(input)-8] ^= 1
+	input = append(input, gzipData(t, data)...)
+
+	got, skips := salvage(t, input)
+	if !bytes.Equal(got, append(bytes.Clone(data), data...)) {
+		t.Errorf("got %q", got)
+	}
+	if len(skips) != 1 || !errors.Is(skips[0].Err, ChecksumMismatch) || skips[0].From != skips[0].To {
+		t.Errorf("skips %v", skips)
+	}
+}
+
+func TestSalvageTruncated(t *testing.T) {
+	data := testInputs()["text"]
+	input := gzipLevel(t, data, 6)
+	input = input[:len(input)/2]
+
+	got, skips := salvage(t, input)
+	if !bytes.HasPrefix(data, got) || len(got) == 0 {
+		t.Errorf("got %d bytes, not a prefix of the input", len(got))
+	}
+	if len(skips) != 1 || skips[0].To != int64(len(input))*8 {
+		t.Errorf("skips %v", skips)
+	}
+}
+
+func TestSalvageIntact(t *testing.T) {
+	data := testInputs()["text"]
+	got, skips := salvage(t, gzipLevel(t, data, 6))
+	if !bytes.Equal(got, data) || len(skips) != 0 {
+		t.Errorf("got %d bytes and skips %v", len(got), skips)
+	}
+}
+
+func TestSalvageNotGzip(t *testing.T) {
+	// nothing decodes: the whole input is skipped
+	input := []byte("not gzip data at all")
+	got, skips := salvage(t, input)
+	if len(got) != 0 || len(skips) != 1 || skips[0].From != 0 || skips[0].To != int64(len(input))*8 {
+		t.Errorf("got %q and skips %v", got, skips)
+	}
+}
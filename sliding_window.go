@@ -1,14 +1,21 @@
-package main
+package gunzip
 
 const WindowSize = MAX_DISTANCE * 3
 
 type SlidingWindow struct {
-	Data     []uint8
-	Boundary int
+	Data        []uint8
+	Boundary    int
+	maxDistance int
 }
 
 func NewSlidingWindow() *SlidingWindow {
-	return &SlidingWindow{make([]uint8, WindowSize), 0}
+	return NewSlidingWindowSize(MAX_DISTANCE)
+}
+
+// NewSlidingWindowSize returns a window keeping maxDistance bytes of history,
+// such as MAX_DISTANCE64 for Deflate64
+func NewSlidingWindowSize(maxDistance int) *SlidingWindow {
+	return &SlidingWindow{make([]uint8, maxDistance*3), 0, maxDistance}
 }
 
 func (w *SlidingWindow) WriteBuffer() []uint8 {
@@ -17,11 +24,21 @@ func (w *SlidingWindow) WriteBuffer() []uint8 {
 
 func (w *SlidingWindow) Slide(n int) {
 	end := w.Boundary + n
-	if end > MAX_DISTANCE {
-		delta := end - MAX_DISTANCE
+	if end > w.maxDistance {
+		delta := end - w.maxDistance
 		copy(w.Data, w.Data[delta:end])
-		w.Boundary = MAX_DISTANCE
+		w.Boundary = w.maxDistance
 	} else {
 		w.Boundary = end
 	}
 }
+
+// Reset forgets the history
+func (w *SlidingWindow) Reset() {
+	w.Boundary = 0
+}
+
+// History returns the last maxDistance bytes written, or fewer at the start
+func (w *SlidingWindow) History() []uint8 {
+	return w.Data[max(0, w.Boundary-w.maxDistance):w.Boundary]
+}
@@ -0,0 +1,32 @@
+package gunzip
+
+import (
+	"io"
+)
+
+// Verify decodes every member of the gzip stream read from reader, checking
+// each member's CRC32 and ISIZE against its footer. The decompressed data is
+// discarded.
+func Verify(reader io.Reader) error {
+	producer := NewProducer(NewBitReader(reader))
+	producer.borrow = true
+	checksum := NewCrc32()
+	for {
+		produce, err := producer.Next()
+		if err != nil {
+			return err
+		}
+		if produce == nil {
+			return nil
+		}
+		if produce.Tag == ProduceHeader {
+			checksum.Reset()
+		} else if produce.Tag == ProduceFooter {
+			if err := produce.Foot.Verify(checksum); err != nil {
+				return producer.annotate(err)
+			}
+		} else if produce.Tag == ProduceData {
+			checksum.Update(produce.Data)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package gunzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	data := testInputs()["text"]
+	member := gzipData(t, data)
+	badCrc := bytes.Clone(member)
+	badCrc[len(badCrc)-8] ^= 1
+	badSize := bytes.Clone(member)
+	badSize[len(badSize)-4] ^= 1
+	tests := []struct {
+		name   string
+		input  []byte
+		err    error
+		member int // member the error is reported in
+	}{
+		{"single", member, nil, 0},
+		{"multi-member", append(bytes.Clone(member), gzipData(t, []byte("second"))...), nil, 0},
+		{"empty member", append(gzipData(t, nil), member...), nil, 0},
+		{"bad crc", append(bytes.Clone(member), badCrc...), ChecksumMismatch, 2},
+		{"bad size", badSize, SizeMismatch, 1},
+		{"trailing garbage", append(bytes.Clone(member), "garbage"...), TrailingGarbage, 1},
+		{"truncated", member[:len(member)-4], io.ErrUnexpectedEOF, 1},
+		{"empty input", nil, EmptyInput, 0},
+	}
+	for _, test := range tests {
+		err := Verify(bytes.NewReader(test.input))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+			continue
+		}
+		var e *Error
+		if test.member > 0 && (!errors.As(err, &e) || e.Member != test.member) {
+			t.Errorf("%s: %v not reported in member %d", test.name, err, test.member)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package gunzip
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// OS byte written to headers, "unknown"
+const OSUnknown = 255
+
+// Writer compresses data written to it into a single gzip member
+type Writer struct {
+	// header fields, written before the first compressed byte
+	Name    string
+	Comment string
+	ModTime time.Time
+
+	writer      io.Writer
+	level       int
+	compressor  *Compressor
+	checksum    Checksum
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewWriter returns a Writer compressing at DefaultCompression
+func NewWriter(writer io.Writer) *Writer {
+	w, _ := NewWriterLevel(writer, DefaultCompression)
+	return w
+}
+
+// NewWriterLevel returns a Writer compressing at the given level, from
+// NoCompression to BestCompression, or DefaultCompression
+func NewWriterLevel(writer io.Writer, level int) (*Writer, error) {
+	compressor, err := NewCompressor(writer, level)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{
+		writer:     writer,
+		level:      compressor.level,
+		compressor: compressor,
+		checksum:   NewCrc32(),
+	}, nil
+}
+
+// Write compresses p. It fails with io.ErrClosedPipe once the writer is
+// closed.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if err := w.writeHeader(); err != nil {
+		return 0, err
+	}
+	w.checksum.Update(p)
+	n, err := w.compressor.Write(p)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+// Flush writes all pending data so that it can be decoded, without ending
+// the member
+func (w *Writer) Flush() error {
+	if w.closed {
+		return io.ErrClosedPipe
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.err = w.compressor.Flush()
+	return w.err
+}
+
+// Close finishes the member by writing the final block and the footer. It
+// does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if w.err = w.compressor.Close(); w.err != nil {
+		return w.err
+	}
+	footer := Footer{w.checksum.Checksum(), uint32(w.checksum.Len())}
+	w.err = WriteFooter(w.writer, &footer)
+	return w.err
+}
+
+func (w *Writer) writeHeader() error {
+	if w.wroteHeader || w.err != nil {
+		return w.err
+	}
+	w.wroteHeader = true
+	var h *Header
+	h, w.err = newWriterHeader(w.Name, w.Comment, w.ModTime, w.level)
+	if w.err != nil {
+		return w.err
+	}
+	w.err = WriteHeader(w.writer, h)
+	return w.err
+}
+
+// newWriterHeader builds the header of a member compressed at level
+func newWriterHeader(name string, comment string, modTime time.Time, level int) (*Header, error) {
+	var h Header
+	var err error
+	h.Header = [10]byte{ID1, ID2, DEFLATE}
+	if name != "" {
+		h.Header[3] |= FNAME
+		if h.RawName, err = latin1(name); err != nil {
+			return nil, err
+		}
+	}
+	if comment != "" {
+		h.Header[3] |= FCOMMENT
+		if h.RawComment, err = latin1(comment); err != nil {
+			return nil, err
+		}
+	}
+	if !modTime.IsZero() && modTime.Unix() > 0 {
+		binary.LittleEndian.PutUint32(h.Header[4:8], uint32(modTime.Unix()))
+	}
+	if level == BestCompression {
+		h.Header[8] = 2
+	} else if level == BestSpeed {
+		h.Header[8] = 4
+	}
+	h.Header[9] = OSUnknown
+	return &h, nil
+}
+
+// latin1 encodes s as ISO-8859-1
+func latin1(s string) ([]byte, error) {
+	buf := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r == 0 || r > 0xFF {
+			return nil, NewError(InvalidGzHeader)
+		}
+		buf = append(buf, byte(r))
+	}
+	return buf, nil
+}
@@ -0,0 +1,212 @@
+package gunzip
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// size of the chunks compressed independently
+const ChunkSize = 128 << 10
+
+// WriterMultithreaded compresses data written to it into a single gzip
+// member, pigz style: the input is split into chunks that are compressed
+// concurrently, each with the preceding MAX_DISTANCE bytes as a preset
+// dictionary, and joined at sync flush boundaries
+type WriterMultithreaded struct {
+	// header fields, written before the first compressed byte
+	Name    string
+	Comment string
+	ModTime time.Time
+
+	writer      io.Writer
+	level       int
+	buf         []uint8 // data of the chunk being filled
+	dict        []uint8 // last MAX_DISTANCE bytes preceding buf
+	jobs        chan *compressJob
+	results     chan *compressJob
+	done        chan struct{}
+	pending     sync.WaitGroup // jobs submitted but not yet written
+	checksum    *Crc32
+	wroteHeader bool
+	closed      bool
+
+	mu  sync.Mutex
+	err error
+}
+
+type compressJob struct {
+	data   []uint8
+	dict   []uint8
+	final  bool
+	output bytes.Buffer
+	crc    uint32
+	done   chan struct{}
+}
+
+// NewWriterMultithreaded returns a WriterMultithreaded compressing at level
+// with the given number of worker goroutines, or one per CPU if workers < 1
+func NewWriterMultithreaded(writer io.Writer, level int, workers int) (*WriterMultithreaded, error) {
+	if _, err := NewCompressor(io.Discard, level); err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	w := &WriterMultithreaded{
+		writer:   writer,
+		level:    level,
+		buf:      make([]uint8, 0, ChunkSize),
+		jobs:     make(chan *compressJob, workers),
+		results:  make(chan *compressJob, 2*workers),
+		done:     make(chan struct{}),
+		checksum: NewCrc32(),
+	}
+	for i := 0; i < workers; i++ {
+		go compressChunks(w.jobs, level)
+	}
+	go w.writeChunks()
+	return w, nil
+}
+
+// compressChunks is a worker compressing jobs with a reused Compressor
+func compressChunks(jobs <-chan *compressJob, level int) {
+	compressor, _ := NewCompressor(io.Discard, level)
+	for job := range jobs {
+		compressor.Reset(&job.output, job.dict)
+		compressor.Write(job.data)
+		if job.final {
+			compressor.Close()
+		} else {
+			compressor.Flush()
+		}
+		job.crc = crc32.ChecksumIEEE(job.data)
+		close(job.done)
+	}
+}
+
+// writeChunks writes compressed chunks in input order and combines their
+// checksums
+func (w *WriterMultithreaded) writeChunks() {
+	defer close(w.done)
+	for job := range w.results {
+		<-job.done
+		if w.getErr() == nil {
+			if _, err := w.writer.Write(job.output.Bytes()); err != nil {
+				w.setErr(err)
+			}
+		}
+		w.checksum.Combine(job.crc, len(job.data))
+		w.pending.Done()
+	}
+}
+
+func (w *WriterMultithreaded) getErr() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *WriterMultithreaded) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// Write compresses p. It fails with io.ErrClosedPipe once the writer is
+// closed.
+func (w *WriterMultithreaded) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if err := w.writeHeader(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		m := min(len(p), ChunkSize-len(w.buf))
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		if len(w.buf) == ChunkSize {
+			w.submit(false)
+		}
+		if err := w.getErr(); err != nil {
+			return n - len(p), err
+		}
+	}
+	return n, nil
+}
+
+// Flush compresses and writes all data written so far, without ending the
+// member
+func (w *WriterMultithreaded) Flush() error {
+	if w.closed {
+		return io.ErrClosedPipe
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if len(w.buf) > 0 {
+		w.submit(false)
+	}
+	w.pending.Wait()
+	return w.getErr()
+}
+
+// Close compresses the remaining data and writes the footer. It does not
+// close the underlying writer.
+func (w *WriterMultithreaded) Close() error {
+	if w.closed {
+		return w.getErr()
+	}
+	w.closed = true
+	if err := w.writeHeader(); err == nil {
+		w.submit(true)
+	}
+	close(w.jobs)
+	close(w.results)
+	<-w.done
+	if err := w.getErr(); err != nil {
+		return err
+	}
+	footer := Footer{w.checksum.Checksum(), uint32(w.checksum.Len())}
+	if err := WriteFooter(w.writer, &footer); err != nil {
+		w.setErr(err)
+	}
+	return w.getErr()
+}
+
+// submit hands the current chunk to the workers and starts a new one
+func (w *WriterMultithreaded) submit(final bool) {
+	job := &compressJob{data: w.buf, dict: w.dict, final: final, done: make(chan struct{})}
+	w.pending.Add(1)
+	w.results <- job
+	w.jobs <- job
+
+	dict := make([]uint8, 0, MAX_DISTANCE)
+	if len(w.buf) < MAX_DISTANCE {
+		dict = append(dict, w.dict[max(0, len(w.dict)+len(w.buf)-MAX_DISTANCE):]...)
+	}
+	w.dict = append(dict, w.buf[max(0, len(w.buf)-MAX_DISTANCE):]...)
+	w.buf = make([]uint8, 0, ChunkSize)
+}
+
+func (w *WriterMultithreaded) writeHeader() error {
+	if w.wroteHeader {
+		return w.getErr()
+	}
+	w.wroteHeader = true
+	h, err := newWriterHeader(w.Name, w.Comment, w.ModTime, w.level)
+	if err == nil {
+		err = WriteHeader(w.writer, h)
+	}
+	if err != nil {
+		w.setErr(err)
+	}
+	return err
+}
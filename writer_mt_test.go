@@ -0,0 +1,98 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWriterMultithreadedRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		for _, level := range []int{NoCompression, BestSpeed, DefaultCompression, BestCompression} {
+			var buf bytes.Buffer
+			w, err := NewWriterMultithreaded(&buf, level, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// uneven writes, so that chunks are filled across calls
+			for rest := data; len(rest) > 0; {
+				n := min(len(rest), 70000)
+				if _, err := w.Write(rest[:n]); err != nil {
+					t.Fatal(err)
+				}
+				rest = rest[n:]
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := io.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%s level %d: round trip mismatch: %v", name, level, err)
+			}
+			r, err := gzip.NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%s level %d: compress/gzip decodes differently: %v", name, level, err)
+			}
+		}
+	}
+}
+
+func TestWriterMultithreadedFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriterMultithreaded(&buf, DefaultCompression, 2)
+	w.Write([]byte("flushed"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 7)
+	if _, err := io.ReadFull(NewReader(bytes.NewReader(buf.Bytes())), got); err != nil || string(got) != "flushed" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	w.Close()
+}
+
+func TestWriterMultithreadedClosed(t *testing.T) {
+	var buf bytes.Buffer
+	w, _ := NewWriterMultithreaded(&buf, DefaultCompression, 2)
+	w.Write([]byte("data"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	size := buf.Len()
+	if _, err := w.Write([]byte("more")); err != io.ErrClosedPipe {
+		t.Errorf("Write after Close: %v", err)
+	}
+	if err := w.Flush(); err != io.ErrClosedPipe {
+		t.Errorf("Flush after Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if buf.Len() != size {
+		t.Errorf("%d bytes written after Close", buf.Len()-size)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestWriterMultithreadedWriteError(t *testing.T) {
+	w, _ := NewWriterMultithreaded(failingWriter{}, DefaultCompression, 2)
+	w.Write(make([]byte, 3*ChunkSize))
+	if err := w.Close(); !errors.Is(err, errWrite) {
+		t.Errorf("Close: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package gunzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// testInputs returns data of various compressibility
+func testInputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 300<<10)
+	rng.Read(random)
+	text := make([]byte, 0, 500<<10)
+	words := []string{"gzip ", "deflate ", "window ", "huffman ", "block ", "member ", "\n"}
+	for len(text) < cap(text)-16 {
+		text = append(text, words[rng.Intn(len(words))]...)
+	}
+	return map[string][]byte{
+		"empty":      {},
+		"byte":       {'x'},
+		"random":     random,
+		"text":       text,
+		"repetitive": bytes.Repeat([]byte("abc"), 200<<10),
+		"zeros":      make([]byte, 1<<20),
+	}
+}
+
+func compress(t *testing.T, data []byte, level int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for name, data := range testInputs() {
+		for level := NoCompression; level <= BestCompression; level++ {
+			compressed := compress(t, data, level)
+
+			got, err := io.ReadAll(NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Fatalf("%s level %d: %v", name, level, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("%s level %d: round trip mismatch", name, level)
+			}
+
+			r, err := gzip.NewReader(bytes.NewReader(compressed))
+			if err != nil {
+				t.Fatalf("%s level %d: compress/gzip: %v", name, level, err)
+			}
+			got, err = io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("%s level %d: compress/gzip decodes differently: %v", name, level, err)
+			}
+		}
+	}
+}
+
+func TestWriterHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Name = "café.txt"
+	w.Comment = "a comment"
+	w.ModTime = time.Unix(1700000000, 0)
+	w.Write([]byte("data"))
+	w.Close()
+
+	d := NewReader(bytes.NewReader(buf.Bytes()))
+	if _, err := io.ReadAll(d); err != nil {
+		t.Fatal(err)
+	}
+	h := d.Header()
+	if string(h.RawName) != "caf\xe9.txt" {
+		t.Errorf("raw name %q", h.RawName)
+	}
+	if h.Name() != w.Name || h.Comment() != w.Comment || !h.ModTime().Equal(w.ModTime) {
+		t.Errorf("header %q %q %v, want %q %q %v", h.Name(), h.Comment(), h.ModTime(), w.Name, w.Comment, w.ModTime)
+	}
+
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != w.Name || r.Comment != w.Comment || !r.ModTime.Equal(w.ModTime) {
+		t.Errorf("header %q %q %v, want %q %q %v", r.Name, r.Comment, r.ModTime, w.Name, w.Comment, w.ModTime)
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte("flushed"))
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// the data so far decodes, although the member is not finished
+	got := make([]byte, 7)
+	if _, err := io.ReadFull(NewReader(bytes.NewReader(buf.Bytes())), got); err != nil || string(got) != "flushed" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	w.Write([]byte(" and closed"))
+	w.Close()
+	got, err := io.ReadAll(NewReader(&buf))
+	if err != nil || string(got) != "flushed and closed" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte("data"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	size := buf.Len()
+	if _, err := w.Write([]byte("more")); err != io.ErrClosedPipe {
+		t.Errorf("Write after Close: %v", err)
+	}
+	if err := w.Flush(); err != io.ErrClosedPipe {
+		t.Errorf("Flush after Close: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	if buf.Len() != size {
+		t.Errorf("%d bytes written after Close", buf.Len()-size)
+	}
+}
+
+func TestWriterInvalidLevel(t *testing.T) {
+	for _, level := range []int{-2, 10} {
+		if _, err := NewWriterLevel(io.Discard, level); !errors.Is(err, InvalidCompressionLevel) {
+			t.Errorf("level %d: %v", level, err)
+		}
+	}
+}
+
+func TestCorruptMember(t *testing.T) {
+	data := testInputs()["text"]
+	compressed := compress(t, data, DefaultCompression)
+	footer := len(compressed) - 8
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+		kind   error
+	}{
+		{"crc", func(b []byte) []byte { b[footer] ^= 1; return b }, ChecksumMismatch},
+		{"size", func(b []byte) []byte { b[footer+4] ^= 1; return b }, SizeMismatch},
+		{"magic", func(b []byte) []byte { b[1] = 0; return b }, InvalidGzHeader},
+		{"truncated data", func(b []byte) []byte { return b[:footer/2] }, io.ErrUnexpectedEOF},
+		{"truncated footer", func(b []byte) []byte { return b[:footer+3] }, io.ErrUnexpectedEOF},
+		{"empty", func(b []byte) []byte { return b[:0] }, EmptyInput},
+	}
+	for _, test := range tests {
+		input := test.modify(append([]byte(nil), compressed...))
+		_, err := io.ReadAll(NewReader(bytes.NewReader(input)))
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.kind)
+		}
+		if err := Verify(bytes.NewReader(input)); !errors.Is(err, test.kind) {
+			t.Errorf("%s: Verify: got %v, want %v", test.name, err, test.kind)
+		}
+	}
+}
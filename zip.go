@@ -0,0 +1,332 @@
+package gunzip
+
+import (
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	zipLocalHeaderSig    = 0x04034b50
+	zipCentralHeaderSig  = 0x02014b50
+	zipEndSig            = 0x06054b50
+	zip64EndSig          = 0x06064b50
+	zip64LocatorSig      = 0x07064b50
+	zipDataDescriptorSig = 0x08074b50
+	zip64ExtraID         = 0x0001
+
+	zipLocalHeaderLen   = 30
+	zipCentralHeaderLen = 46
+	zipEndLen           = 22
+	zip64EndLen         = 56
+	zip64LocatorLen     = 20
+	zipMaxCommentLen    = 0xFFFF
+)
+
+// compression methods of ZIP entries
+const (
+	ZipStore     = 0
+	ZipDeflate   = 8
+	ZipDeflate64 = 9
+)
+
+// general purpose flags of ZIP entries
+const (
+	ZipFlagEncrypted      = 0x1
+	ZipFlagDataDescriptor = 0x8
+)
+
+// ZipEntry describes a file in a ZIP archive, as recorded in the central
+// directory
+type ZipEntry struct {
+	Name             string
+	Comment          string
+	Method           uint16
+	Flags            uint16
+	Modified         time.Time
+	Crc32            uint32
+	CompressedSize   uint64
+	UncompressedSize uint64
+	ExternalAttrs    uint32
+	Extra            []byte
+	HeaderOffset     int64 // offset of the local header
+}
+
+// IsDir reports whether the entry names a directory
+func (e *ZipEntry) IsDir() bool {
+	return strings.HasSuffix(e.Name, "/")
+}
+
+// ZipReader reads the entries of a ZIP archive
+type ZipReader struct {
+	input   io.ReaderAt
+	size    int64
+	Entries []*ZipEntry
+	Comment string
+}
+
+// NewZipReader parses the central directory of the ZIP archive of the given
+// size in input
+func NewZipReader(input io.ReaderAt, size int64) (*ZipReader, error) {
+	z := &ZipReader{input: input, size: size}
+	offset, count, err := z.readEnd()
+	if err != nil {
+		return nil, err
+	}
+	reader := NewBitReader(io.NewSectionReader(input, offset, size-offset))
+	for i := uint64(0); i < count; i++ {
+		entry, err := readZipCentralHeader(reader)
+		if err != nil {
+			return nil, err
+		}
+		if entry.HeaderOffset < 0 || entry.HeaderOffset >= size {
+			return nil, NewError(InvalidZipArchive)
+		}
+		z.Entries = append(z.Entries, entry)
+	}
+	return z, nil
+}
+
+// readEnd locates the end of central directory record, following the ZIP64
+// locator if there is one, and returns the offset of the central directory
+// and its number of entries
+func (z *ZipReader) readEnd() (int64, uint64, error) {
+	// the record is followed by a comment of up to 64 KiB
+	tailLen := min(z.size, zipEndLen+zipMaxCommentLen)
+	tail := make([]byte, tailLen)
+	if _, err := z.input.ReadAt(tail, z.size-tailLen); err != nil && err != io.EOF {
+		return 0, 0, err
+	}
+	pos := -1
+	for i := len(tail) - zipEndLen; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(tail[i:]) == zipEndSig {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return 0, 0, NewError(InvalidZipArchive)
+	}
+	end := tail[pos:]
+	count := uint64(binary.LittleEndian.Uint16(end[10:]))
+	offset := uint64(binary.LittleEndian.Uint32(end[16:]))
+	commentLen := int(binary.LittleEndian.Uint16(end[20:]))
+	z.Comment = string(end[zipEndLen:min(len(end), zipEndLen+commentLen)])
+
+	endOffset := z.size - tailLen + int64(pos)
+	if endOffset >= zip64LocatorLen {
+		var locator [zip64LocatorLen]byte
+		if _, err := z.input.ReadAt(locator[:], endOffset-zip64LocatorLen); err != nil {
+			return 0, 0, err
+		}
+		if binary.LittleEndian.Uint32(locator[:]) == zip64LocatorSig {
+			var end64 [zip64EndLen]byte
+			end64Offset := int64(binary.LittleEndian.Uint64(locator[8:]))
+			if end64Offset < 0 || end64Offset > z.size-zip64EndLen {
+				return 0, 0, NewError(InvalidZipArchive)
+			}
+			if _, err := z.input.ReadAt(end64[:], end64Offset); err != nil {
+				return 0, 0, err
+			}
+			if binary.LittleEndian.Uint32(end64[:]) != zip64EndSig {
+				return 0, 0, NewError(InvalidZipArchive)
+			}
+			count = binary.LittleEndian.Uint64(end64[32:])
+			offset = binary.LittleEndian.Uint64(end64[48:])
+		}
+	}
+	// every central header takes at least zipCentralHeaderLen bytes
+	if offset > uint64(z.size) || count > uint64(z.size-int64(offset))/zipCentralHeaderLen {
+		return 0, 0, NewError(InvalidZipArchive)
+	}
+	return int64(offset), count, nil
+}
+
+func readZipCentralHeader(reader BitRead) (*ZipEntry, error) {
+	var h [zipCentralHeaderLen]byte
+	if err := reader.ReadExact(h[:]); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(h[:]) != zipCentralHeaderSig {
+		return nil, NewError(InvalidZipArchive)
+	}
+	e := &ZipEntry{
+		Flags:            binary.LittleEndian.Uint16(h[8:]),
+		Method:           binary.LittleEndian.Uint16(h[10:]),
+		Modified:         dosTime(binary.LittleEndian.Uint16(h[14:]), binary.LittleEndian.Uint16(h[12:])),
+		Crc32:            binary.LittleEndian.Uint32(h[16:]),
+		CompressedSize:   uint64(binary.LittleEndian.Uint32(h[20:])),
+		UncompressedSize: uint64(binary.LittleEndian.Uint32(h[24:])),
+		ExternalAttrs:    binary.LittleEndian.Uint32(h[38:]),
+		HeaderOffset:     int64(binary.LittleEndian.Uint32(h[42:])),
+	}
+	name := make([]byte, binary.LittleEndian.Uint16(h[28:]))
+	e.Extra = make([]byte, binary.LittleEndian.Uint16(h[30:]))
+	comment := make([]byte, binary.LittleEndian.Uint16(h[32:]))
+	for _, field := range [][]byte{name, e.Extra, comment} {
+		if err := reader.ReadExact(field); err != nil {
+			return nil, err
+		}
+	}
+	e.Name, e.Comment = string(name), string(comment)
+	if err := e.readZip64Extra(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// readZip64Extra replaces the 32-bit fields saturated at 0xFFFFFFFF with the
+// values from the ZIP64 extra field, which appear in a fixed order
+func (e *ZipEntry) readZip64Extra() error {
+	extra := e.Extra
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			return NewError(InvalidZipArchive)
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != zip64ExtraID {
+			continue
+		}
+		next := func(value *uint64) error {
+			if *value != 0xFFFFFFFF {
+				return nil
+			}
+			if len(field) < 8 {
+				return NewError(InvalidZipArchive)
+			}
+			*value = binary.LittleEndian.Uint64(field)
+			field = field[8:]
+			return nil
+		}
+		offset := uint64(e.HeaderOffset)
+		for _, value := range []*uint64{&e.UncompressedSize, &e.CompressedSize, &offset} {
+			if err := next(value); err != nil {
+				return err
+			}
+		}
+		e.HeaderOffset = int64(offset)
+	}
+	return nil
+}
+
+// hasZip64Extra reports whether an extra field holds a ZIP64 record
+func hasZip64Extra(extra []byte) bool {
+	for len(extra) >= 4 {
+		if binary.LittleEndian.Uint16(extra) == zip64ExtraID {
+			return true
+		}
+		extra = extra[min(len(extra), 4+int(binary.LittleEndian.Uint16(extra[2:]))):]
+	}
+	return false
+}
+
+// dosTime converts an MS-DOS date and time to local time
+func dosTime(date uint16, t uint16) time.Time {
+	return time.Date(
+		int(date>>9)+1980, time.Month(date>>5&0xF), int(date&0x1F),
+		int(t>>11), int(t>>5&0x3F), int(t&0x1F)*2, 0, time.Local)
+}
+
+// Open returns a reader for the decompressed content of an entry. The CRC32
+// and size recorded in the central directory are checked once the reader
+// reaches the end of the entry.
+func (z *ZipReader) Open(e *ZipEntry) (io.Reader, error) {
+	if e.Flags&ZipFlagEncrypted != 0 {
+		return nil, NewError(UnsupportedZipMethod)
+	}
+	var local [zipLocalHeaderLen]byte
+	if _, err := z.input.ReadAt(local[:], e.HeaderOffset); err != nil {
+		return nil, eofIsUnexpected(err)
+	}
+	if binary.LittleEndian.Uint32(local[:]) != zipLocalHeaderSig {
+		return nil, NewError(InvalidZipArchive)
+	}
+	nameLen := int64(binary.LittleEndian.Uint16(local[26:]))
+	extra := make([]byte, binary.LittleEndian.Uint16(local[28:]))
+	if _, err := z.input.ReadAt(extra, e.HeaderOffset+zipLocalHeaderLen+nameLen); err != nil {
+		return nil, eofIsUnexpected(err)
+	}
+	offset := e.HeaderOffset + zipLocalHeaderLen + nameLen + int64(len(extra))
+	if e.CompressedSize > uint64(z.size-min(offset, z.size)) {
+		return nil, NewError(InvalidZipArchive)
+	}
+	if e.Flags&ZipFlagDataDescriptor != 0 {
+		if err := z.checkDataDescriptor(e, offset+int64(e.CompressedSize), hasZip64Extra(extra)); err != nil {
+			return nil, err
+		}
+	}
+
+	data := io.NewSectionReader(z.input, offset, int64(e.CompressedSize))
+	var reader io.Reader
+	switch e.Method {
+	case ZipStore:
+		reader = data
+	case ZipDeflate:
+		reader = NewRawReader(data)
+	case ZipDeflate64:
+		reader = NewDeflate64Reader(data)
+	default:
+		return nil, NewError(UnsupportedZipMethod)
+	}
+	return &zipEntryReader{reader, e, NewCrc32(), false}, nil
+}
+
+// checkDataDescriptor compares the data descriptor following the data of an
+// entry, which has an optional signature, with the central directory. Its
+// sizes take 8 bytes if the local header has a ZIP64 extra field.
+func (z *ZipReader) checkDataDescriptor(e *ZipEntry, offset int64, zip64 bool) error {
+	var desc [24]byte
+	n, err := z.input.ReadAt(desc[:], offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	fields := desc[:n]
+	if len(fields) >= 4 && binary.LittleEndian.Uint32(fields) == zipDataDescriptorSig {
+		fields = fields[4:]
+	}
+	sizeLen := 4
+	if zip64 {
+		sizeLen = 8
+	}
+	if len(fields) < 4+2*sizeLen {
+		return NewError(InvalidZipArchive)
+	}
+	compressed, uncompressed := uint64(binary.LittleEndian.Uint32(fields[4:])), uint64(binary.LittleEndian.Uint32(fields[8:]))
+	if zip64 {
+		compressed, uncompressed = binary.LittleEndian.Uint64(fields[4:]), binary.LittleEndian.Uint64(fields[12:])
+	}
+	if binary.LittleEndian.Uint32(fields) != e.Crc32 || compressed != e.CompressedSize || uncompressed != e.UncompressedSize {
+		return NewError(InvalidZipArchive)
+	}
+	return nil
+}
+
+// zipEntryReader verifies the CRC32 and size of an entry at its end
+type zipEntryReader struct {
+	reader   io.Reader
+	entry    *ZipEntry
+	checksum Checksum
+	done     bool
+}
+
+func (r *zipEntryReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	n, err := r.reader.Read(p)
+	r.checksum.Update(p[:n])
+	if err == io.EOF {
+		r.done = true
+		if r.checksum.Checksum() != r.entry.Crc32 {
+			return n, NewError(ChecksumMismatch)
+		}
+		if uint64(r.checksum.Len()) != r.entry.UncompressedSize {
+			return n, NewError(SizeMismatch)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,296 @@
+package gunzip
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// zipEntries returns the names and contents of the files of testZip
+func zipEntries() map[string][]byte {
+	return map[string][]byte{
+		"stored.txt":   []byte("stored without compression"),
+		"deflated.txt": bytes.Repeat([]byte("deflated data "), 10000),
+		"raw.bin":      parallelInput()[:200000],
+		"empty":        {},
+	}
+}
+
+// testZip builds an archive with archive/zip. Entries written with Create
+// use data descriptors, raw.bin is written without.
+func testZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range zipEntries() {
+		if name == "raw.bin" {
+			var deflated bytes.Buffer
+			fw, _ := flate.NewWriter(&deflated, flate.BestCompression)
+			fw.Write(data)
+			fw.Close()
+			header := &zip.FileHeader{
+				Name:               name,
+				Method:             zip.Deflate,
+				CRC32:              crc32.ChecksumIEEE(data),
+				CompressedSize64:   uint64(deflated.Len()),
+				UncompressedSize64: uint64(len(data)),
+			}
+			fw2, err := w.CreateRaw(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw2.Write(deflated.Bytes())
+			continue
+		}
+		method := zip.Deflate
+		if name == "stored.txt" {
+			method = zip.Store
+		}
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	w.Create("dir/")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readZipEntry(z *ZipReader, e *ZipEntry) ([]byte, error) {
+	r, err := z.Open(e)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestZipReader(t *testing.T) {
+	archive := testZip(t)
+	z, err := NewZipReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := zipEntries()
+	if len(z.Entries) != len(entries)+1 {
+		t.Fatalf("%d entries, want %d", len(z.Entries), len(entries)+1)
+	}
+	for _, e := range z.Entries {
+		if e.IsDir() {
+			if e.Name != "dir/" {
+				t.Errorf("unexpected directory %s", e.Name)
+			}
+			continue
+		}
+		got, err := readZipEntry(z, e)
+		if err != nil {
+			t.Fatalf("%s: %v", e.Name, err)
+		}
+		if !bytes.Equal(got, entries[e.Name]) {
+			t.Errorf("%s: content differs", e.Name)
+		}
+	}
+}
+
+func TestZipReaderZip64(t *testing.T) {
+	// more entries than the 16-bit count of the end record can hold
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	const count = 0x10010
+	for i := 0; i < count; i++ {
+		fw, _ := w.CreateHeader(&zip.FileHeader{Name: fmt.Sprint(i), Method: zip.Store})
+		fmt.Fprint(fw, i)
+	}
+	w.Close()
+	archive := buf.Bytes()
+
+	z, err := NewZipReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(z.Entries) != count {
+		t.Fatalf("%d entries, want %d", len(z.Entries), count)
+	}
+	last := z.Entries[count-1]
+	if got, err := readZipEntry(z, last); err != nil || string(got) != last.Name {
+		t.Fatalf("last entry: %q, %v", got, err)
+	}
+}
+
+// findEntry returns the entry of archive with the given name
+func findEntry(t *testing.T, archive []byte, name string) *ZipEntry {
+	t.Helper()
+	z, err := NewZipReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range z.Entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	t.Fatalf("no entry %s", name)
+	return nil
+}
+
+func TestZipReaderErrors(t *testing.T) {
+	archive := testZip(t)
+	stored := findEntry(t, archive, "stored.txt")
+	raw := findEntry(t, archive, "raw.bin")
+	// offset of the data of stored.txt, after its local header and name
+	data := stored.HeaderOffset + zipLocalHeaderLen + int64(len(stored.Name))
+
+	corrupt := func(modify func([]byte)) []byte {
+		b := append([]byte(nil), archive...)
+		modify(b)
+		return b
+	}
+	tests := []struct {
+		name    string
+		archive []byte
+		entry   string
+		kind    error
+	}{
+		{"crc", corrupt(func(b []byte) { b[data] ^= 1 }), "stored.txt", ChecksumMismatch},
+		{"deflate data", corrupt(func(b []byte) { copy(b[raw.HeaderOffset+40:], make([]byte, 2000)) }), "raw.bin", nil},
+		{"local header", corrupt(func(b []byte) { b[stored.HeaderOffset] = 'X' }), "stored.txt", InvalidZipArchive},
+		{"encrypted", archive, "encrypted", UnsupportedZipMethod},
+		{"method", archive, "method", UnsupportedZipMethod},
+	}
+	for _, test := range tests {
+		z, err := NewZipReader(bytes.NewReader(test.archive), int64(len(test.archive)))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var entry *ZipEntry
+		for _, e := range z.Entries {
+			if e.Name == test.entry {
+				entry = e
+			}
+		}
+		if entry == nil {
+			// a copy of stored.txt with a modified central directory record
+			e := *findEntry(t, test.archive, "stored.txt")
+			if test.entry == "encrypted" {
+				e.Flags |= ZipFlagEncrypted
+			} else {
+				e.Method = 99
+			}
+			entry = &e
+		}
+		_, err = readZipEntry(z, entry)
+		if test.kind == nil {
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+		} else if !errors.Is(err, test.kind) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.kind)
+		}
+	}
+
+	for _, truncated := range [][]byte{archive[:len(archive)-10], archive[:100], nil} {
+		if _, err := NewZipReader(bytes.NewReader(truncated), int64(len(truncated))); !errors.Is(err, InvalidZipArchive) {
+			t.Errorf("truncated to %d bytes: %v", len(truncated), err)
+		}
+	}
+}
+
+// deflate64Data returns a Deflate64 stream built by hand from the format
+// description, and its content: 70000 bytes of stored history followed by a
+// fixed Huffman block with matches that only Deflate64 can express
+func deflate64Data() ([]byte, []byte) {
+	var b bitPacker
+	history := parallelInput()[:70000]
+	for start := 0; start < len(history); start += 65535 {
+		chunk := history[start:min(start+65535, len(history))]
+		b.write(0b000, 3) // stored
+		b.write(0, 5)
+		b.write(uint64(len(chunk)), 16)
+		b.write(uint64(^uint16(len(chunk))), 16)
+		for _, c := range chunk {
+			b.write(uint64(c), 8)
+		}
+	}
+	content := bytes.Clone(history)
+	match := func(length, distance int) {
+		for i := 0; i < length; i++ {
+			content = append(content, content[len(content)-distance])
+		}
+	}
+
+	b.write(0b011, 3) // final, fixed
+	// length code 285 takes 16 extra bits, distance code 31 reaches 64 KiB
+	b.writeCode(0xc0+285-280, 8)
+	b.write(1000-3, 16)
+	b.writeCode(31, 5)
+	b.write(65536-49153, 14)
+	match(1000, 65536)
+	// length code 257, distance code 30
+	b.writeCode(257-256, 7)
+	b.writeCode(30, 5)
+	b.write(40000-32769, 14)
+	match(3, 40000)
+	// the longest match
+	b.writeCode(0xc0+285-280, 8)
+	b.write(65538-3, 16)
+	b.writeCode(0, 5)
+	match(65538, 1)
+	b.writeCode(0x30+'x', 8)
+	content = append(content, 'x')
+	b.writeCode(0, 7) // end of block
+	return b.bytes(), content
+}
+
+func TestDeflate64(t *testing.T) {
+	deflate64, want := deflate64Data()
+	got, err := io.ReadAll(NewDeflate64Reader(bytes.NewReader(deflate64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("output mismatch")
+	}
+	// distance codes 30 and 31 are invalid in deflate
+	var b bitPacker
+	b.write(0b011, 3)
+	b.writeCode(0x30+'a', 8)
+	b.writeCode(257-256, 7)
+	b.writeCode(30, 5)
+	b.write(0, 14)
+	b.writeCode(0, 7)
+	if _, err := io.ReadAll(NewRawReader(bytes.NewReader(b.bytes()))); !errors.Is(err, HuffmanDecoderCodeNotFound) {
+		t.Errorf("deflate decoding distance code 30: %v", err)
+	}
+
+	// as ZIP method 9
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	fw, err := w.CreateRaw(&zip.FileHeader{
+		Name:               "deflate64.bin",
+		Method:             ZipDeflate64,
+		CRC32:              crc32.ChecksumIEEE(want),
+		CompressedSize64:   uint64(len(deflate64)),
+		UncompressedSize64: uint64(len(want)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(deflate64)
+	w.Close()
+	archive := buf.Bytes()
+	z, err := NewZipReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = readZipEntry(z, findEntry(t, archive, "deflate64.bin"))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("ZIP entry: %v", err)
+	}
+}